@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
 	"testing"
 	"time"
@@ -21,6 +22,16 @@ func BenchmarkOriginalMonteCarloTreeSearch(b *testing.B) {
 		OriginalMonteCarloTreeSearch(node, 500, rng)
 	}
 }
+func BenchmarkOriginalMonteCarloTreeSearchTable(b *testing.B) {
+	node := InitialRootNode()
+	node.Table = NewMCTSTable(DEFAULT_MCTS_TABLE_SIZE)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for b.Loop() {
+		OriginalMonteCarloTreeSearch(node, 500, rng)
+	}
+	b.ReportMetric(node.Table.HitRate(), "hitrate")
+}
+
 func BenchmarkMonteCarloTreeSearchPUCT(b *testing.B) {
 	node := InitialRootPUCTNode()
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -29,19 +40,47 @@ func BenchmarkMonteCarloTreeSearchPUCT(b *testing.B) {
 	}
 }
 
+func BenchmarkMonteCarloTreeSearchPUCTTable(b *testing.B) {
+	node := InitialRootPUCTNode()
+	node.Table = NewMCTSTable(DEFAULT_MCTS_TABLE_SIZE)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for b.Loop() {
+		MonteCarloTreeSearchPUCT(node, 500, rng)
+	}
+	b.ReportMetric(node.Table.HitRate(), "hitrate")
+}
+
 func BenchmarkSingleRunParallelizationMCTS(b *testing.B) {
 	node := InitialRootNode()
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	pool := NewSearchPool(SearchWorkers, rng)
 	for b.Loop() {
-		SingleRunParallelizationMCTS(node, 50, rng)
+		pool.SingleRunParallelizationMCTS(node, 50, rng)
+	}
+}
+
+func BenchmarkLeafParallelizationMCTS(b *testing.B) {
+	node := InitialRootNode()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for b.Loop() {
+		LeafParallelizationMCTS(node, 50, rng)
 	}
 }
 
 func BenchmarkSingleRunParallelizationMCTSPUCT(b *testing.B) {
+	node := InitialRootPUCTNode()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	pool := NewSearchPool(SearchWorkers, rng)
+	for b.Loop() {
+		pool.SingleRunParallelizationMCTSPUCT(node, 200, rng)
+	}
+}
+
+func BenchmarkTreeParallelizationMCTSPUCT(b *testing.B) {
 	node := InitialRootPUCTNode()
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 	for b.Loop() {
-		SingleRunParallelizationMCTSPUCT(node, 200, rng)
+		TreeParallelizationMCTSPUCT(node, 200, rng)
 	}
 }
 
@@ -53,6 +92,42 @@ func BenchmarkRollout(b *testing.B) {
 	}
 }
 
+// benchmarkRolloutWith runs rollouts from the start with the given move generator and reports rollouts per second.
+func benchmarkRolloutWith(b *testing.B, useGenerator func()) {
+	useGenerator()
+	defer UseKoggeStone()
+	node := InitialRootNode()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for b.Loop() {
+		SimulateRollout(node.GameState, rng)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "rollouts/s")
+}
+
+func BenchmarkRolloutDumb7fill(b *testing.B) {
+	benchmarkRolloutWith(b, UseDumb7fill)
+}
+
+func BenchmarkRolloutKoggeStone(b *testing.B) {
+	benchmarkRolloutWith(b, UseKoggeStone)
+}
+
+func BenchmarkDumb7fillMoves(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	myDisks, oppDisks := randomDisjointBoards(rng)
+	for b.Loop() {
+		Dumb7fillMoves(myDisks, oppDisks)
+	}
+}
+
+func BenchmarkKoggeStoneMoves(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	myDisks, oppDisks := randomDisjointBoards(rng)
+	for b.Loop() {
+		KoggeStoneMoves(myDisks, oppDisks)
+	}
+}
+
 func BenchmarkRolloutParallel(b *testing.B) {
 	nodeP := InitialRootNode()
 	b.RunParallel(func(pb *testing.PB) {
@@ -79,3 +154,61 @@ func BenchmarkVersus(b *testing.B) {
 		Versus()
 	}
 }
+
+// randomPositionWithEmpties plays random moves from the start until only the given number of empties remain.
+func randomPositionWithEmpties(empties int, rng *rand.Rand) State {
+	for {
+		current := InitialRootNode().GameState
+		for !IsTerminalState(current) && current.Boards.EmptySquares() > empties {
+			var moves uint64
+			if current.BlackTurn {
+				moves = generateMoves(current.Boards.Black, current.Boards.White)
+			} else {
+				moves = generateMoves(current.Boards.White, current.Boards.Black)
+			}
+			if moves == 0 {
+				current.BlackTurn = !current.BlackTurn
+				continue
+			}
+			moveArray := FastArrayOfMoves(moves)
+			current.Boards.MakeMoveIndex(current.BlackTurn, moveArray[rng.Intn(len(moveArray))])
+			current.BlackTurn = !current.BlackTurn
+		}
+		if !IsTerminalState(current) && current.Boards.HasValidMove(current.BlackTurn) {
+			return current
+		}
+	}
+}
+
+func BenchmarkSolveEndgame(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	state := randomPositionWithEmpties(16, rng)
+	for b.Loop() {
+		SolveEndgame(state)
+	}
+}
+
+// BenchmarkSolveEndgameEmpties solves the same 10 random positions for every number of empties,
+// the time per position is what a move costs when the solver takes over at that number (see EndgameEmpties).
+func BenchmarkSolveEndgameEmpties(b *testing.B) {
+	for _, empties := range []int{12, 14, 16, 18} {
+		b.Run(fmt.Sprintf("empties=%d", empties), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			states := make([]State, 10)
+			for i := range states {
+				states[i] = randomPositionWithEmpties(empties, rng)
+			}
+			nodes, worst := 0, time.Duration(0)
+			for b.Loop() {
+				for _, state := range states {
+					start := time.Now()
+					nodes += SolveEndgame(state).Nodes
+					worst = max(worst, time.Since(start))
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(states)), "ns/position")
+			b.ReportMetric(float64(worst.Milliseconds()), "worst-ms")
+			b.ReportMetric(float64(nodes)/float64(b.N*len(states)), "nodes/position")
+		})
+	}
+}
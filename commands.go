@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs the command given in the arguments of the program (without the program name).
+// Returns false if there is no such command.
+// A seed given with SEED_ENV makes the searches of the command reproducible (see DeterministicSearch).
+func runCommand(args []string) bool {
+	if _, found := seedFromEnv(); found {
+		DeterministicSearch = true
+	}
+	switch args[0] {
+	case "perft":
+		runPerft(args[1:])
+	case "play":
+		runPlay(args[1:])
+	case "nboard":
+		runNBoard()
+	case "gtp":
+		runGTP(args[1:])
+	case "server":
+		runServer(args[1:])
+	case "versus":
+		runVersus(args[1:])
+	default:
+		return false
+	}
+	return true
+}
+
+// runPerft prints the perft counts from the starting position up to the given depth.
+// With "divide" it also prints the count of every root move at that depth.
+// Usage: perft <depth> [divide]
+func runPerft(args []string) {
+	depth := 10
+	if len(args) > 0 {
+		parsed, err := strconv.Atoi(args[0])
+		if err != nil || parsed < 0 {
+			fmt.Println("Invalid depth:", args[0])
+			return
+		}
+		depth = parsed
+	}
+	state := InitialState()
+	if len(args) > 1 && args[1] == "divide" {
+		divide := PerftDivide(state, depth)
+		var total uint64
+		for _, move := range FastArrayOfMoves(legalMovesOf(state)) {
+			fmt.Printf("%s: %d\n", MoveString(move), divide[move])
+			total += divide[move]
+		}
+		fmt.Printf("Total: %d\n", total)
+		return
+	}
+	for d := 1; d <= depth; d++ {
+		start := time.Now()
+		nodes := Perft(state, d)
+		status := ""
+		if d < len(PerftResults) && nodes != PerftResults[d] {
+			status = fmt.Sprintf(" (WRONG, expected %d)", PerftResults[d])
+		}
+		fmt.Printf("perft(%d) = %d%s in %s\n", d, nodes, status, time.Since(start))
+	}
+}
+
+// runPlay plays a game in the terminal against an engine, SingleRunParallelizationMCTS if no engine is given.
+// Moves are entered and printed in standard notation (like d3).
+// Usage: play [engine]
+func runPlay(args []string) {
+	engine, ok := engineFromArgs(args, "uct-root-parallel")
+	if !ok {
+		return
+	}
+	state := engine.State()
+	state.Boards.PrintBoard()
+	userIsBlack := RequestUserIsBlack()
+	ponderer := NewPonderer(engine) // The engine thinks while the user enters the move
+	for !IsTerminalState(state) {
+		userTurn := state.BlackTurn == userIsBlack
+		var move uint8
+		if userTurn {
+			state.PrintBoardWithMoves()
+			ponderer.Start()
+			move = RequestMove(state)
+			ponderer.Stop()
+		} else {
+			var stats SearchStats
+			move, stats = engine.BestMove(context.Background(), Limits{Iterations: 5000})
+			if stats.Probes > 0 {
+				fmt.Printf("Transposition table: %d lookups, %.1f%% hits\n", stats.Probes, 100*float64(stats.Hits)/float64(stats.Probes))
+			}
+		}
+		if err := engine.Play(move); err != nil {
+			panic(err) // RequestMove and the engine only return legal moves
+		}
+		state = engine.State()
+		if !userTurn {
+			fmt.Println("Engine plays:", MoveString(move))
+			state.Boards.PrintBoard()
+		}
+	}
+	var emptyMove uint8
+	OutputResult(NewNode(state, nil, emptyMove))
+}
+
+// engineFromArgs returns the engine named by the first argument (or defaultName if there are no arguments).
+// It prints the error and returns false if there is no such engine.
+func engineFromArgs(args []string, defaultName string) (Engine, bool) {
+	name := defaultName
+	if len(args) > 0 {
+		name = args[0]
+	}
+	engine, err := TryNewEngine(name, rand.New(rand.NewSource(NewSeed())))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	return engine, true
+}
+
+// runNBoard runs the engine for the NBoard GUI, talking the NBoard protocol on stdin and stdout.
+func runNBoard() {
+	engine := NewNBoardEngine(os.Stdout, rand.New(rand.NewSource(NewSeed())))
+	if err := RunNBoard(os.Stdin, engine); err != nil {
+		fmt.Fprintln(os.Stderr, "nboard:", err)
+	}
+}
+
+// runGTP runs the engine in GTP mode on stdin and stdout, for match runners.
+// Usage: gtp [engine]
+func runGTP(args []string) {
+	search, ok := engineFromArgs(args, DEFAULT_ENGINE)
+	if !ok {
+		return
+	}
+	engine := NewGTPEngine(os.Stdout, rand.New(rand.NewSource(NewSeed())))
+	engine.Engine = search
+	if err := RunGTP(os.Stdin, engine); err != nil {
+		fmt.Fprintln(os.Stderr, "gtp:", err)
+	}
+}
+
+// runServer runs the HTTP/JSON analysis server, on localhost:8080 if no address is given.
+// Usage: server [address]
+func runServer(args []string) {
+	addr := "localhost:8080"
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	fmt.Println("Analysis server listening on", addr)
+	if err := ServeAnalysis(addr); err != nil {
+		fmt.Fprintln(os.Stderr, "server:", err)
+	}
+}
+
+// runVersus plays games between two engines and prints the results, the games are saved as records and GGF.
+// Every engine is given as name:iterations (per routine for the parallel searches), see EngineNames.
+// The match is played again move for move with the seed it prints.
+// Usage: versus [baseline:iterations opponent:iterations [games [seed]]]
+func runVersus(args []string) {
+	players := []string{"uct:500", "puct-root-parallel:200"}
+	Games := 100
+	if len(args) >= 2 {
+		players = args[:2]
+	}
+	if len(args) > 2 {
+		games, err := strconv.Atoi(args[2])
+		if err != nil || games <= 0 {
+			fmt.Println("Invalid number of games:", args[2])
+			return
+		}
+		Games = games
+	}
+	seed := NewSeed()
+	if len(args) > 3 {
+		parsed, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			fmt.Println("Invalid seed:", args[3])
+			return
+		}
+		seed = parsed
+		DeterministicSearch = true
+	}
+	fmt.Println("GOMAXPROCS:", runtime.GOMAXPROCS(0))
+	fmt.Println("Seed:", seed)
+	start := time.Now()
+	// Each engine has its own tree and a stream of the seed, the parallel searches split it again for their routines
+	var engines [2]Engine
+	var limits [2]Limits
+	var info [2]PlayerInfo
+	for i, player := range players {
+		name, iterations, found := strings.Cut(player, ":")
+		limits[i] = Limits{Iterations: 500}
+		if found {
+			parsed, err := strconv.Atoi(iterations)
+			if err != nil || parsed <= 0 {
+				fmt.Println("Invalid iterations:", player)
+				return
+			}
+			limits[i].Iterations = parsed
+		}
+		engine, err := TryNewEngine(name, NewStreamRNG(seed, i))
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		engines[i] = engine
+		info[i] = PlayerInfo{Name: name, Config: fmt.Sprintf("%d iterations", limits[i].Iterations), Seed: SplitSeed(seed, i)}
+	}
+	baseline, opponent := engines[0], engines[1]
+	OpponentWinCounter := 0
+	DrawsCounter := 0
+	records := make([]*GameRecord, 0, Games)
+	for i := 0; i < Games; i++ {
+		OpponentIsBlack := false // Is the opponent of baseline black?
+		var record *GameRecord
+		if OpponentIsBlack {
+			record = PlayEngines(opponent, baseline, [2]Limits{limits[1], limits[0]}, [2]PlayerInfo{info[1], info[0]})
+		} else {
+			record = PlayEngines(baseline, opponent, limits, info)
+		}
+		records = append(records, record)
+		switch WinnerState(record.State()) {
+		case BLACK_WIN:
+			if OpponentIsBlack {
+				OpponentWinCounter++
+			}
+		case WHITE_WIN:
+			if !OpponentIsBlack {
+				OpponentWinCounter++
+			}
+		case DRAW:
+			DrawsCounter++
+		}
+		fmt.Printf("Number of finalized games: %d\n", i+1)
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("%s vs %s\n", players[0], players[1])
+	fmt.Printf("Opponent Wins: %d\n", OpponentWinCounter)
+	fmt.Printf("Draws: %d\n", DrawsCounter)
+	fmt.Printf("Total Games ran: %d\n", Games)
+	fmt.Printf("Total run time for all the games: %s\n", elapsed)
+	// The games can be replayed with LoadGameRecords
+	recordsPath := fmt.Sprintf("versus-%d.txt", seed)
+	if err := SaveGameRecords(recordsPath, records); err != nil {
+		fmt.Println("Could not save the games:", err)
+	} else {
+		fmt.Println("Games saved to", recordsPath)
+	}
+	// And in GGF to share them with other Othello programs
+	ggfGames := make([]GGFGame, len(records))
+	for i, record := range records {
+		ggfGames[i] = GGFFromRecord(record)
+	}
+	ggfPath := fmt.Sprintf("versus-%d.ggf", seed)
+	if err := SaveGGF(ggfPath, ggfGames); err != nil {
+		fmt.Println("Could not save the games:", err)
+	} else {
+		fmt.Println("Games saved to", ggfPath)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Engine is a player that keeps its own game and search tree. Every search algorithm is wrapped in an
+// Engine (see Engines), so the GUI, the versus runner and the protocols can swap algorithms by name.
+// The tree is kept between moves: Play reuses the subtree of the move when the search expanded it.
+type Engine interface {
+	// Name returns the name of the engine in Engines.
+	Name() string
+	// NewGame starts a new game from the initial position.
+	NewGame()
+	// Reset discards the tree and continues the game from the given position.
+	Reset(state State)
+	// Play makes a move of the side to move, or returns an error if the move cannot be made (see State.TryMove).
+	Play(move uint8) error
+	// BestMove searches the current position until the limits are reached or ctx is cancelled,
+	// and returns the chosen move without playing it. Returns PASS_MOVE if the game is over.
+	BestMove(ctx context.Context, limits Limits) (uint8, SearchStats)
+	// BestMoveOnClock is BestMove for a player with the time left and the increment after the move,
+	// the time manager decides how long the search runs.
+	BestMoveOnClock(ctx context.Context, tm *TimeManager, left, increment time.Duration) (uint8, SearchStats)
+	// State returns the current position.
+	State() State
+}
+
+// SearchStats are the statistics of the move chosen by a search.
+type SearchStats struct {
+	Visits   int           // Visits of the move in the tree
+	Playouts int           // Playouts of the search (0 if the solver chose the move)
+	WinRate  float64       // Win rate of the move for the side that plays it, a draw counts as a win (UCT) or half (PUCT)
+	Duration time.Duration // Time spent in the search
+	Probes   int64         // Lookups in the transposition table of the engine since it was made (0 without a table)
+	Hits     int64         // Lookups that found their position
+}
+
+// ErrUnknownEngine is returned when there is no engine with the given name.
+var ErrUnknownEngine = errors.New("unknown engine")
+
+// Engines are the constructors of the engines by name.
+var Engines = map[string]func(rng *rand.Rand) Engine{
+	"uct": func(rng *rand.Rand) Engine {
+		return newNodeEngine("uct", OriginalMonteCarloTreeSearchContext, rng)
+	},
+	"uct-inaccurate": func(rng *rand.Rand) Engine {
+		return newNodeEngine("uct-inaccurate", inaccurateSearch, rng)
+	},
+	"uct-root-parallel": func(rng *rand.Rand) Engine {
+		return newNodeEngine("uct-root-parallel", NewSearchPool(SearchWorkers, rng).SingleRunParallelizationMCTSContext, rng)
+	},
+	"uct-leaf-parallel": func(rng *rand.Rand) Engine {
+		return newNodeEngine("uct-leaf-parallel", LeafParallelizationMCTSContext, rng)
+	},
+	"puct": func(rng *rand.Rand) Engine {
+		return newPUCTEngine("puct", MonteCarloTreeSearchPUCTContext, rng)
+	},
+	"puct-root-parallel": func(rng *rand.Rand) Engine {
+		return newPUCTEngine("puct-root-parallel", NewSearchPool(SearchWorkers, rng).SingleRunParallelizationMCTSPUCTContext, rng)
+	},
+	"puct-tree-parallel": func(rng *rand.Rand) Engine {
+		return newPUCTEngine("puct-tree-parallel", TreeParallelizationMCTSPUCTContext, rng)
+	},
+}
+
+// DEFAULT_ENGINE is the engine of the GUI and the protocols.
+const DEFAULT_ENGINE = "puct-root-parallel"
+
+// ENGINE_TABLE_SUFFIX after the name of an engine (like puct-tt) gives the engine a transposition table
+// (a MCTSTable of DEFAULT_MCTS_TABLE_SIZE) that every tree of the engine shares, also between games.
+// The inaccurate and the shared tree searches never store in it, so their tables stay empty.
+const ENGINE_TABLE_SUFFIX = "-tt"
+
+// EngineNames returns the names of the engines in alphabetical order (without ENGINE_TABLE_SUFFIX).
+func EngineNames() []string {
+	names := make([]string, 0, len(Engines))
+	for name := range Engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEngine returns a new engine by name that uses rng for its searches.
+// It panics if there is no such engine, use TryNewEngine for names that come from the user.
+func NewEngine(name string, rng *rand.Rand) Engine {
+	engine, err := TryNewEngine(name, rng)
+	if err != nil {
+		panic(err)
+	}
+	return engine
+}
+
+// TryNewEngine returns a new engine by name that uses rng for its searches, or ErrUnknownEngine.
+// The name can end with ENGINE_TABLE_SUFFIX.
+func TryNewEngine(name string, rng *rand.Rand) (Engine, error) {
+	base, withTable := strings.CutSuffix(name, ENGINE_TABLE_SUFFIX)
+	newEngine, found := Engines[base]
+	if !found {
+		return nil, fmt.Errorf("%w %q (the engines are %v, optionally with %s)", ErrUnknownEngine, name, EngineNames(), ENGINE_TABLE_SUFFIX)
+	}
+	engine := newEngine(rng)
+	if withTable {
+		engine.(tableEngine).setTable(name, NewMCTSTable(DEFAULT_MCTS_TABLE_SIZE))
+	}
+	return engine, nil
+}
+
+// tableEngine is an engine that can share a transposition table between its trees.
+type tableEngine interface {
+	// setTable renames the engine and attaches the table to its tree, and to the trees of the next games.
+	setTable(name string, table *MCTSTable)
+}
+
+// tableStats sets the table statistics of the stats, if there is a table.
+func tableStats(stats *SearchStats, table *MCTSTable) {
+	if table != nil {
+		stats.Probes, stats.Hits = table.Probes.Load(), table.Hits.Load()
+	}
+}
+
+// inaccurateSearch runs InnacurateMonteCarloTreeSearchContext optimizing for the side to move.
+func inaccurateSearch(ctx context.Context, root *Node, limits Limits, rng *rand.Rand) (*Node, int) {
+	optimizeFor := OPTIMIZE_FOR_WHITE
+	if root.GameState.BlackTurn {
+		optimizeFor = OPTIMIZE_FOR_BLACK
+	}
+	return InnacurateMonteCarloTreeSearchContext(ctx, root, limits, optimizeFor, rng)
+}
+
+// nodeSearch is a search over a Node tree, it returns the child of the chosen move and the playouts.
+type nodeSearch func(ctx context.Context, root *Node, limits Limits, rng *rand.Rand) (*Node, int)
+
+// puctSearch is a search over a PUCTNode tree, it returns the child of the chosen move and the playouts.
+type puctSearch func(ctx context.Context, root *PUCTNode, limits Limits, rng *rand.Rand) (*PUCTNode, int)
+
+// nodeEngine is the Engine of the searches over Node trees (UCT).
+type nodeEngine struct {
+	name   string
+	search nodeSearch
+	node   *Node
+	rng    *rand.Rand
+	table  *MCTSTable // Transposition table of the trees, nil without ENGINE_TABLE_SUFFIX
+}
+
+// newNodeEngine returns an engine at the initial position that plays with search.
+func newNodeEngine(name string, search nodeSearch, rng *rand.Rand) *nodeEngine {
+	return &nodeEngine{name: name, search: search, node: InitialRootNode(), rng: rng}
+}
+
+func (e *nodeEngine) Name() string { return e.name }
+
+func (e *nodeEngine) NewGame() {
+	e.node = InitialRootNode()
+	e.node.Table = e.table
+}
+
+func (e *nodeEngine) Reset(state State) {
+	var emptyMove uint8
+	e.node = NewNode(state, nil, emptyMove)
+	e.node.Table = e.table
+}
+
+func (e *nodeEngine) setTable(name string, table *MCTSTable) {
+	e.name, e.table = name, table
+	e.node.Table = table
+}
+
+func (e *nodeEngine) State() State { return e.node.GameState }
+
+func (e *nodeEngine) Play(move uint8) error {
+	next, err := TryNextNodeFromInput(e.node, move)
+	if err != nil {
+		return err
+	}
+	e.node = next
+	return nil
+}
+
+func (e *nodeEngine) BestMove(ctx context.Context, limits Limits) (uint8, SearchStats) {
+	if e.node.IsTerminal() {
+		return PASS_MOVE, SearchStats{}
+	}
+	start := time.Now()
+	best, playouts := e.search(ctx, e.node, limits, e.rng)
+	return best.Move, e.stats(best.Move, playouts, start)
+}
+
+func (e *nodeEngine) BestMoveOnClock(ctx context.Context, tm *TimeManager, left, increment time.Duration) (uint8, SearchStats) {
+	root := e.node
+	if root.IsTerminal() || len(root.UntriedMoves)+len(root.Children) == 1 {
+		return e.BestMove(ctx, Limits{Iterations: 1, NoSolver: true}) // The only move
+	}
+	start := time.Now()
+	move, playouts := searchOnClock(ctx, tm, left, increment, root.GameState,
+		func(ctx context.Context, limits Limits) (uint8, bool) {
+			if best := solvedBestNodeWithin(ctx, root, limits); best != nil {
+				return best.Move, true
+			}
+			return PASS_MOVE, false
+		},
+		func(ctx context.Context, limits Limits) (uint8, int) {
+			best, playouts := e.search(ctx, root, limits, e.rng)
+			return best.Move, playouts
+		},
+		func(visits []int) []int {
+			for _, child := range root.Children {
+				visits = append(visits, child.Visits)
+			}
+			return visits
+		})
+	return move, e.stats(move, playouts, start)
+}
+
+// stats returns the statistics of the search of a move that started at start.
+func (e *nodeEngine) stats(move uint8, playouts int, start time.Time) SearchStats {
+	stats := SearchStats{Playouts: playouts, Duration: time.Since(start)}
+	for _, child := range e.node.Children {
+		if child.Move == move && child.Visits > 0 {
+			stats.Visits = child.Visits
+			stats.WinRate = float64(child.Wins) / float64(child.Visits)
+		}
+	}
+	tableStats(&stats, e.table)
+	return stats
+}
+
+// puctEngine is the Engine of the searches over PUCTNode trees.
+type puctEngine struct {
+	name   string
+	search puctSearch
+	node   *PUCTNode
+	rng    *rand.Rand
+	table  *MCTSTable // Transposition table of the trees, nil without ENGINE_TABLE_SUFFIX
+}
+
+// newPUCTEngine returns an engine at the initial position that plays with search.
+func newPUCTEngine(name string, search puctSearch, rng *rand.Rand) *puctEngine {
+	return &puctEngine{name: name, search: search, node: InitialRootPUCTNode(), rng: rng}
+}
+
+func (e *puctEngine) Name() string { return e.name }
+
+func (e *puctEngine) NewGame() {
+	e.node = InitialRootPUCTNode()
+	e.node.Table = e.table
+}
+
+func (e *puctEngine) Reset(state State) {
+	var emptyMove uint8
+	e.node = NewPUCTNode(state, nil, emptyMove)
+	e.node.Table = e.table
+}
+
+func (e *puctEngine) setTable(name string, table *MCTSTable) {
+	e.name, e.table = name, table
+	e.node.Table = table
+}
+
+func (e *puctEngine) State() State { return e.node.GameState }
+
+func (e *puctEngine) Play(move uint8) error {
+	next, err := TryNextPUCTNodeFromInput(e.node, move)
+	if err != nil {
+		return err
+	}
+	e.node = next
+	return nil
+}
+
+func (e *puctEngine) BestMove(ctx context.Context, limits Limits) (uint8, SearchStats) {
+	if e.node.IsTerminalPUCT() {
+		return PASS_MOVE, SearchStats{}
+	}
+	start := time.Now()
+	best, playouts := e.search(ctx, e.node, limits, e.rng)
+	return best.Move, e.stats(best.Move, playouts, start)
+}
+
+func (e *puctEngine) BestMoveOnClock(ctx context.Context, tm *TimeManager, left, increment time.Duration) (uint8, SearchStats) {
+	root := e.node
+	if root.IsTerminalPUCT() || len(root.UntriedMoves)+len(root.Children) == 1 {
+		return e.BestMove(ctx, Limits{Iterations: 1, NoSolver: true}) // The only move
+	}
+	start := time.Now()
+	move, playouts := searchOnClock(ctx, tm, left, increment, root.GameState,
+		func(ctx context.Context, limits Limits) (uint8, bool) {
+			if best := solvedBestNodePUCTWithin(ctx, root, limits); best != nil {
+				return best.Move, true
+			}
+			return PASS_MOVE, false
+		},
+		func(ctx context.Context, limits Limits) (uint8, int) {
+			best, playouts := e.search(ctx, root, limits, e.rng)
+			return best.Move, playouts
+		},
+		func(visits []int) []int {
+			for _, child := range root.Children {
+				visits = append(visits, child.Visits)
+			}
+			return visits
+		})
+	return move, e.stats(move, playouts, start)
+}
+
+// stats returns the statistics of the search of a move that started at start.
+func (e *puctEngine) stats(move uint8, playouts int, start time.Time) SearchStats {
+	stats := SearchStats{Playouts: playouts, WinRate: e.node.Q[move], Duration: time.Since(start)}
+	for _, child := range e.node.Children {
+		if child.Move == move {
+			stats.Visits = child.Visits
+		}
+	}
+	tableStats(&stats, e.table)
+	return stats
+}
+
+// searchOnClock runs the search of an engine on the clock (see Engine.BestMoveOnClock) from state and
+// returns the best move and the playouts (0 if the solver chose the move). solve returns the best move if
+// the solve finishes within the limits, search runs a chunk and returns its best move and playouts, and
+// visits appends the visits of the children of the root.
+func searchOnClock(ctx context.Context, tm *TimeManager, left, increment time.Duration, state State,
+	solve func(ctx context.Context, limits Limits) (uint8, bool),
+	search func(ctx context.Context, limits Limits) (uint8, int),
+	visits func(visits []int) []int) (uint8, int) {
+	start := time.Now()
+	empties := state.Boards.EmptySquares()
+	if ShouldSolve(state) {
+		// The solve is charged to the clock: it gets half of the hard limit of the move, if it does not
+		// finish in time the search plays the move with the time that is left
+		_, hard := tm.Allocate(left, increment, empties)
+		if move, solved := solve(ctx, Limits{Deadline: start.Add(hard / 2)}); solved {
+			return move, 0
+		}
+	}
+	var childVisits []int
+	return tm.Search(ctx, left-time.Since(start), increment, empties, func(ctx context.Context, limits Limits) (int, uint8, int, int) {
+		limits.NoSolver = true // The solver already had its time
+		move, playouts := search(ctx, limits)
+		childVisits = visits(childVisits[:0])
+		first, second := topVisits(childVisits)
+		return playouts, move, first, second
+	})
+}
+
+// PlayEngines plays a game between two engines from the initial position and returns its record.
+// Both engines are told every move, so each one keeps its own tree. Position 0 is black, position 1 is white.
+func PlayEngines(black, white Engine, limits [2]Limits, info [2]PlayerInfo) *GameRecord {
+	engines := [2]Engine{black, white}
+	for _, engine := range engines {
+		engine.NewGame()
+	}
+	record := NewGameRecord(info[0], info[1])
+	for state := record.State(); !IsTerminalState(state); state = record.State() {
+		side := 1
+		if state.BlackTurn {
+			side = 0
+		}
+		move, stats := engines[side].BestMove(context.Background(), limits[side])
+		record.Play(move, MoveStats{Visits: stats.Visits, Duration: stats.Duration})
+		for _, engine := range engines {
+			if err := engine.Play(move); err != nil {
+				panic(err) // The move was legal for the record, so both engines are out of sync
+			}
+		}
+	}
+	return record
+}
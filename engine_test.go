@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestEnginesPlayLegalGames(t *testing.T) {
+	defer func(empties int) { EndgameEmpties = empties }(EndgameEmpties)
+	EndgameEmpties = 10 // Faster games
+	for i, name := range EngineNames() {
+		rng := rand.New(rand.NewSource(int64(i)))
+		black := NewEngine(name, rng)
+		white := NewEngine(name, rng)
+		if black.Name() != name {
+			t.Errorf("engine %q is named %q", name, black.Name())
+		}
+		limits := Limits{Iterations: 20}
+		record := PlayEngines(black, white, [2]Limits{limits, limits}, [2]PlayerInfo{{Name: name}, {Name: name}})
+		if !IsTerminalState(record.State()) {
+			t.Errorf("%s: the game did not end", name)
+		}
+		if _, err := record.Replay(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if black.State() != record.State() || white.State() != record.State() {
+			t.Errorf("%s: the engines are not at the end of the game", name)
+		}
+		if move, _ := black.BestMove(context.Background(), limits); move != PASS_MOVE {
+			t.Errorf("%s: BestMove of a finished game = %s", name, MoveString(move))
+		}
+	}
+}
+
+func TestEnginePlayAndReset(t *testing.T) {
+	for _, name := range EngineNames() {
+		engine := NewEngine(name, rand.New(rand.NewSource(1)))
+		if err := engine.Play(0); err == nil {
+			t.Errorf("%s: a1 accepted at the start", name)
+		}
+		if err := engine.Play(19); err != nil {
+			t.Fatalf("%s: d3: %v", name, err)
+		}
+		want := InitialState()
+		want.ApplyMove(19)
+		if state := engine.State(); state != want {
+			t.Errorf("%s: state after d3 = %s", name, state.PositionString())
+		}
+		move, stats := engine.BestMove(context.Background(), Limits{Iterations: 100})
+		if err := engine.Play(move); err != nil {
+			t.Errorf("%s: BestMove answered %s: %v", name, MoveString(move), err)
+		}
+		if stats.Visits <= 0 || stats.WinRate < 0 {
+			t.Errorf("%s: stats = %+v", name, stats)
+		}
+		engine.Reset(want)
+		if state := engine.State(); state != want {
+			t.Errorf("%s: state after Reset = %s", name, state.PositionString())
+		}
+		engine.NewGame()
+		if engine.State() != InitialState() {
+			t.Errorf("%s: NewGame did not start from the initial position", name)
+		}
+	}
+}
+
+func TestTryNewEngineUnknown(t *testing.T) {
+	if _, err := TryNewEngine("minimax", rand.New(rand.NewSource(1))); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("TryNewEngine(minimax) error = %v", err)
+	}
+}
+
+func TestEngineTable(t *testing.T) {
+	for _, name := range EngineNames() {
+		engine := NewEngine(name+ENGINE_TABLE_SUFFIX, rand.New(rand.NewSource(1)))
+		if engine.Name() != name+ENGINE_TABLE_SUFFIX {
+			t.Errorf("engine %q is named %q", name+ENGINE_TABLE_SUFFIX, engine.Name())
+		}
+		engine.BestMove(context.Background(), Limits{Iterations: 200})
+		engine.NewGame() // The next game finds the positions of the first one (if the search stores them)
+		_, stats := engine.BestMove(context.Background(), Limits{Iterations: 200})
+		if stats.Probes == 0 || (stats.Hits == 0 && name != "uct-inaccurate" && name != "puct-tree-parallel") {
+			t.Errorf("%s: %d lookups and %d hits in the table", name, stats.Probes, stats.Hits)
+		}
+		if _, stats := NewEngine(name, rand.New(rand.NewSource(1))).BestMove(context.Background(), Limits{Iterations: 20}); stats.Probes != 0 {
+			t.Errorf("%s: %d lookups without a table", name, stats.Probes)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Live game server over WebSocket. Every connection is a game session with its own Engine
+// (GAME_SERVER_ENGINE) and random number generator, so sessions never share search state. The messages are JSON objects with a type:
+//
+//	client: {"type": "new", "black": "human", "white": "engine", "iterations": 5000}   start a game
+//	client: {"type": "move", "move": "d3"}                                             move of a human
+//	server: {"type": "state", "position": ..., "moves": [...], ...}                    see PositionResponse
+//	server: {"type": "thinking", "best": "d3", "visits": 1200, "winRate": 0.54, "iterations": 1250}
+//	server: {"type": "thinking", "solving": true}                                      the solver is playing
+//	server: {"type": "move", "move": "d3"}                                             move of the engine
+//	server: {"type": "error", "error": "..."}
+//
+// Players are "human" or "engine" (engine vs engine games play until the end by themselves).
+// The search runs in chunks, a thinking message is sent after each one, and at most MaxSearches
+// chunks of all the sessions run at the same time. Close to the end the solver plays instead: it runs
+// in the background for at most SolveTime, taking a search slot like a chunk, and a thinking message is
+// sent every gameServerThinkingInterval. A new game cancels it, and if it does not finish the search plays.
+
+// Limits of the game server.
+const (
+	GAME_SERVER_MAX_SESSIONS       = 64
+	GAME_SERVER_DEFAULT_ITERATIONS = 5000
+	GAME_SERVER_MAX_ITERATIONS     = 200000
+	GAME_SERVER_SOLVE_TIME         = 5 * time.Second
+	GAME_SERVER_ENGINE             = "puct"                 // Engine of the sessions, a single routine per search slot
+	gameServerChunk                = 250                    // Iterations between thinking messages
+	gameServerThinkingInterval     = 200 * time.Millisecond // Time between thinking messages of the solver
+)
+
+// GameServer is the HTTP handler that runs the WebSocket game sessions.
+type GameServer struct {
+	MaxSessions int
+	SolveTime   time.Duration // Time the solver may take for a move
+	searches    chan struct{} // Semaphore of the searches running
+	mu          sync.Mutex
+	sessions    int
+	nextID      int64
+	upgrader    websocket.Upgrader
+}
+
+// gameMessage is a message from the client, every type uses some of the fields.
+type gameMessage struct {
+	Type       string `json:"type"`
+	Black      string `json:"black"`
+	White      string `json:"white"`
+	Iterations int    `json:"iterations"`
+	Move       string `json:"move"`
+}
+
+// GameEvent is a message to the client, every type uses some of the fields.
+type GameEvent struct {
+	Type string `json:"type"`
+	*PositionResponse
+	Move       string  `json:"move,omitempty"`
+	Best       string  `json:"best,omitempty"`
+	Visits     int     `json:"visits,omitempty"`
+	WinRate    float64 `json:"winRate,omitempty"`
+	Iterations int     `json:"iterations,omitempty"`
+	Solving    bool    `json:"solving,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// gameSession is the game of one connection.
+type gameSession struct {
+	engine     Engine
+	plays      [2]bool // The engine plays black (position 0) or white (position 1)
+	iterations int
+	moves      []uint8
+}
+
+// NewGameServer returns a game server that accepts maxSessions connections and runs maxSearches searches at a time.
+func NewGameServer(maxSessions, maxSearches int) *GameServer {
+	return &GameServer{
+		MaxSessions: maxSessions,
+		SolveTime:   GAME_SERVER_SOLVE_TIME,
+		searches:    make(chan struct{}, maxSearches),
+	}
+}
+
+// ServeHTTP upgrades the connection to WebSocket and runs its session until it is closed.
+func (s *GameServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.sessions >= s.MaxSessions {
+		s.mu.Unlock()
+		http.Error(w, "too many sessions", http.StatusServiceUnavailable)
+		return
+	}
+	s.sessions++
+	s.nextID++
+	id := s.nextID
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sessions--
+		s.mu.Unlock()
+	}()
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade already answered the error
+	}
+	defer conn.Close()
+	session := &gameSession{
+		// Each session has its own rng, like the parallel workers
+		engine:     NewEngine(GAME_SERVER_ENGINE, NewStreamRNG(NewSeed(), int(id))),
+		plays:      [2]bool{false, true},
+		iterations: GAME_SERVER_DEFAULT_ITERATIONS,
+	}
+	s.runSession(conn, session)
+}
+
+// runSession answers the messages of the client and plays the moves of the engine.
+func (s *GameServer) runSession(conn *websocket.Conn, session *gameSession) {
+	messages := make(chan gameMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(messages)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var message gameMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				message = gameMessage{Type: "invalid"}
+			}
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if !send(conn, session.stateEvent()) {
+		return
+	}
+	for {
+		var message gameMessage
+		if session.engineToMove() {
+			pending, alive := s.playEngineMove(conn, session, messages)
+			if !alive {
+				return
+			}
+			if pending == nil {
+				continue
+			}
+			message = *pending
+		} else {
+			var ok bool
+			if message, ok = <-messages; !ok {
+				return
+			}
+		}
+		var event GameEvent
+		if err := session.handle(message); err != nil {
+			event = GameEvent{Type: "error", Error: err.Error()}
+		} else {
+			event = session.stateEvent()
+		}
+		if !send(conn, event) {
+			return
+		}
+	}
+}
+
+// send writes an event to the client, returns false if the connection is broken.
+func send(conn *websocket.Conn, event GameEvent) bool {
+	return conn.WriteJSON(event) == nil
+}
+
+// playEngineMove searches and plays the move of the engine, sending thinking messages.
+// If the client starts a new game meanwhile the search stops and the message is returned.
+// Returns alive false if the connection was closed.
+func (s *GameServer) playEngineMove(conn *websocket.Conn, session *gameSession, messages <-chan gameMessage) (*gameMessage, bool) {
+	engine := session.engine
+	move, chosen := PASS_MOVE, false
+	if ShouldSolve(engine.State()) {
+		var pending *gameMessage
+		var alive bool
+		if move, chosen, pending, alive = s.solveEngineMove(conn, engine, messages); pending != nil || !alive {
+			return pending, alive
+		}
+	}
+	for done := 0; !chosen; {
+		chunk := min(gameServerChunk, session.iterations-done)
+		s.searches <- struct{}{}
+		leader, stats := engine.BestMove(context.Background(), Limits{Iterations: chunk, NoSolver: true})
+		<-s.searches
+		done += chunk
+
+		thinking := GameEvent{
+			Type:       "thinking",
+			Best:       MoveString(leader),
+			Visits:     stats.Visits,
+			WinRate:    stats.WinRate,
+			Iterations: done,
+		}
+		if !send(conn, thinking) {
+			return nil, false
+		}
+		if done >= session.iterations {
+			move, chosen = leader, true
+		}
+
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return nil, false
+			}
+			if message.Type == "new" {
+				return &message, true
+			}
+			if !send(conn, GameEvent{Type: "error", Error: "the engine is thinking"}) {
+				return nil, false
+			}
+		default:
+		}
+	}
+	if err := engine.Play(move); err != nil {
+		panic(err) // The engine chose the move in its own position
+	}
+	session.moves = append(session.moves, move)
+	return nil, send(conn, GameEvent{Type: "move", Move: MoveString(move)}) && send(conn, session.stateEvent())
+}
+
+// solveEngineMove solves the position of the engine in the background, sending thinking messages meanwhile.
+// Returns the best move and solved true, or solved false if the solve did not finish within SolveTime.
+// If the client starts a new game meanwhile the solve is cancelled and the message is returned.
+// Returns alive false if the connection was closed.
+func (s *GameServer) solveEngineMove(conn *websocket.Conn, engine Engine, messages <-chan gameMessage) (uint8, bool, *gameMessage, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.SolveTime)
+	defer cancel()
+	s.searches <- struct{}{}
+	type solve struct {
+		move  uint8
+		stats SearchStats
+	}
+	solved := make(chan solve, 1)
+	go func() {
+		defer func() { <-s.searches }()
+		// If the solve does not finish the search falls back to MCTS, the single playout is not a solve
+		move, stats := engine.BestMove(ctx, Limits{Iterations: 1})
+		solved <- solve{move, stats}
+	}()
+	// stop cancels the solve and waits for it, the engine is not used by the solve anymore
+	stop := func(pending *gameMessage, alive bool) (uint8, bool, *gameMessage, bool) {
+		cancel()
+		<-solved
+		return PASS_MOVE, false, pending, alive
+	}
+	ticker := time.NewTicker(gameServerThinkingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case result := <-solved:
+			return result.move, result.stats.Playouts == 0, nil, true
+		case <-ticker.C:
+			if !send(conn, GameEvent{Type: "thinking", Solving: true}) {
+				return stop(nil, false)
+			}
+		case message, ok := <-messages:
+			if !ok {
+				return stop(nil, false)
+			}
+			if message.Type == "new" {
+				return stop(&message, true)
+			}
+			if !send(conn, GameEvent{Type: "error", Error: "the engine is thinking"}) {
+				return stop(nil, false)
+			}
+		}
+	}
+}
+
+// engineToMove returns true if the game is not over and the engine plays the side to move.
+func (session *gameSession) engineToMove() bool {
+	state := session.engine.State()
+	if IsTerminalState(state) {
+		return false
+	}
+	if state.BlackTurn {
+		return session.plays[0]
+	}
+	return session.plays[1]
+}
+
+// stateEvent returns the state message of the current position.
+func (session *gameSession) stateEvent() GameEvent {
+	response := positionResponse(session.engine.State())
+	response.History = MovesString(session.moves)
+	return GameEvent{Type: "state", PositionResponse: &response}
+}
+
+// handle applies a message of the client to the session.
+func (session *gameSession) handle(message gameMessage) error {
+	switch message.Type {
+	case "new":
+		plays := [2]bool{}
+		for i, player := range []string{message.Black, message.White} {
+			switch player {
+			case "human":
+			case "engine":
+				plays[i] = true
+			default:
+				return fmt.Errorf("player %q is not human or engine", player)
+			}
+		}
+		iterations := message.Iterations
+		if iterations == 0 {
+			iterations = GAME_SERVER_DEFAULT_ITERATIONS
+		}
+		if iterations < 0 || iterations > GAME_SERVER_MAX_ITERATIONS {
+			return fmt.Errorf("iterations must be between 1 and %d", GAME_SERVER_MAX_ITERATIONS)
+		}
+		session.engine.NewGame()
+		session.plays = plays
+		session.iterations = iterations
+		session.moves = nil
+	case "move":
+		if IsTerminalState(session.engine.State()) {
+			return ErrGameOver
+		}
+		if session.engineToMove() {
+			return ErrWrongTurn
+		}
+		move, err := ParseMove(message.Move)
+		if err != nil {
+			return err
+		}
+		if err := session.engine.Play(move); err != nil {
+			return err
+		}
+		session.moves = append(session.moves, move)
+	default:
+		return fmt.Errorf("unknown message type %q", message.Type)
+	}
+	return nil
+}
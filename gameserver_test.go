@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialGameServer opens a session with the game server.
+func dialGameServer(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// readEvent reads the next event of the session.
+func readEvent(t *testing.T, conn *websocket.Conn) GameEvent {
+	t.Helper()
+	var event GameEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// readUntil reads events until one of the type.
+func readUntil(t *testing.T, conn *websocket.Conn, eventType string) GameEvent {
+	t.Helper()
+	for {
+		if event := readEvent(t, conn); event.Type == eventType {
+			return event
+		}
+	}
+}
+
+func TestGameServerHumanVsEngine(t *testing.T) {
+	server := httptest.NewServer(NewGameServer(4, 2))
+	defer server.Close()
+	conn := dialGameServer(t, server)
+	defer conn.Close()
+
+	if event := readEvent(t, conn); event.Type != "state" || !event.BlackTurn || len(event.Moves) != 4 {
+		t.Fatalf("first event = %+v", event)
+	}
+	conn.WriteJSON(gameMessage{Type: "new", Black: "human", White: "engine", Iterations: 600})
+	readUntil(t, conn, "state")
+	conn.WriteJSON(gameMessage{Type: "move", Move: "a1"})
+	if event := readEvent(t, conn); event.Type != "error" {
+		t.Errorf("illegal move answered %+v", event)
+	}
+	conn.WriteJSON(gameMessage{Type: "move", Move: "f5"})
+	if event := readEvent(t, conn); event.Type != "state" || event.BlackTurn || event.History != "f5" {
+		t.Fatalf("after f5 = %+v", event)
+	}
+	thinking := 0
+	var event GameEvent
+	for event = readEvent(t, conn); event.Type == "thinking"; event = readEvent(t, conn) {
+		thinking++
+		if event.Visits <= 0 || event.WinRate < 0 || event.WinRate > 1 {
+			t.Errorf("thinking = %+v", event)
+		}
+	}
+	if thinking != 600/gameServerChunk+1 {
+		t.Errorf("%d thinking messages, want %d", thinking, 600/gameServerChunk+1)
+	}
+	if event.Type != "move" {
+		t.Fatalf("engine answered %+v", event)
+	}
+	if state := readEvent(t, conn); state.History != "f5"+event.Move || !state.BlackTurn {
+		t.Errorf("after the engine move = %+v", state)
+	}
+}
+
+func TestGameServerConcurrentEngineGames(t *testing.T) {
+	defer func(empties int) { EndgameEmpties = empties }(EndgameEmpties)
+	EndgameEmpties = 10 // Faster games
+	server := httptest.NewServer(NewGameServer(3, 1))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		conn := dialGameServer(t, server)
+		defer conn.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := playEngineGame(conn); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The sessions are all in use
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("session over the limit answered %d", resp.StatusCode)
+	}
+}
+
+// playEngineGame plays an engine vs engine game in the session and replays it when it ends.
+func playEngineGame(conn *websocket.Conn) error {
+	var event GameEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		return err
+	}
+	conn.WriteJSON(gameMessage{Type: "new", Black: "engine", White: "engine", Iterations: 50})
+	for {
+		event = GameEvent{}
+		if err := conn.ReadJSON(&event); err != nil {
+			return err
+		}
+		if event.Type == "error" {
+			return errors.New(event.Error)
+		}
+		if event.Type == "state" && event.GameOver {
+			moves, err := ParseMoves(event.History)
+			if err != nil {
+				return err
+			}
+			_, err = ReplayGame(moves)
+			return err
+		}
+	}
+}
+
+func TestGameServerSearchesWhenTheSolveDoesNotFit(t *testing.T) {
+	gameServer := NewGameServer(1, 1)
+	gameServer.SolveTime = time.Millisecond // The default EndgameEmpties, no solve finishes
+	server := httptest.NewServer(gameServer)
+	defer server.Close()
+	conn := dialGameServer(t, server)
+	defer conn.Close()
+	if err := playEngineGame(conn); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGameServerNewGameCancelsTheSolve(t *testing.T) {
+	defer func(empties int) { EndgameEmpties = empties }(EndgameEmpties)
+	EndgameEmpties = 40 // The solve never finishes
+	server := httptest.NewServer(NewGameServer(1, 1))
+	defer server.Close()
+	conn := dialGameServer(t, server)
+	defer conn.Close()
+	readUntil(t, conn, "state")
+	conn.WriteJSON(gameMessage{Type: "new", Black: "engine", White: "engine", Iterations: 20})
+	for event := readEvent(t, conn); !event.Solving; event = readEvent(t, conn) {
+	}
+	conn.WriteJSON(gameMessage{Type: "move", Move: "a1"})
+	readUntil(t, conn, "error") // The engine is thinking
+	start := time.Now()
+	conn.WriteJSON(gameMessage{Type: "new", Black: "human", White: "human"})
+	if event := readUntil(t, conn, "state"); event.History != "" {
+		t.Errorf("the new game starts at %+v", event)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the solve took %s to stop", elapsed)
+	}
+}
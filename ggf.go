@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GGF (Generic Game Format) is the format of the games of the online Othello servers (GGS).
+// A game is a list of properties KEY[value] between "(;" and ";)", for example:
+//
+//	(;GM[Othello]PC[GGS/os]DT[2003.12.15_13:24:03.MET]PB[player1]PW[player2]RB[2197.72]RW[2199.38]
+//	TI[15:00//02:00]TY[8]RE[+2.000]BO[8 -------- -------- -------- ---O*--- ---*O--- -------- -------- -------- *]
+//	B[F5//0.01]W[D6/-1.50/2.31]B[C3]...;)
+//
+// BO is the start position row by row (* black, O white, - empty) and the side to move, the moves are
+// B[move/eval/time] and W[move/eval/time] (eval and time can be left out) and a pass is PA.
+// RE is the disc difference for black, optionally followed by :r (resignation), :t (timeout) or :s (mutual score).
+// A file can have many games (a tournament), one after the other.
+// Only standard 8x8 boards are supported and unknown properties are ignored.
+
+// ErrInvalidGGF is returned when a GGF game cannot be parsed or replayed.
+var ErrInvalidGGF = errors.New("invalid GGF game")
+
+// GGFMove is a move of a GGF game with the evaluation and the time used (0 if they were not given).
+type GGFMove struct {
+	Move uint8   // Move index or PASS_MOVE
+	Eval float64 // Evaluation of the player that moved
+	Time time.Duration
+}
+
+// GGFGame is a game in GGF.
+type GGFGame struct {
+	Place       string // PC
+	Date        string // DT
+	Black       string // PB
+	White       string // PW
+	BlackRating float64
+	WhiteRating float64
+	TimeControl string // TI, like 15:00//02:00
+	BoardType   string // TY, 8 is the standard board
+	Start       State  // BO, the side to move is as written (no automatic pass)
+	Moves       []GGFMove
+	Result      float64 // RE, disc difference for black
+	ResultType  string  // "" normal end, "r" resignation, "t" timeout, "s" mutual score, "?" unknown
+}
+
+// GGFFromRecord returns a GGF game with the moves and the result of a game record.
+// The result gives the empty squares to the winner, like the solver (see finalDiscDifferential).
+// The passes that the record leaves out are written explicitly, GGF needs them.
+func GGFFromRecord(record *GameRecord) GGFGame {
+	game := GGFGame{
+		Black:     record.Black.Name,
+		White:     record.White.Name,
+		BoardType: "8",
+		Start:     InitialState(),
+	}
+	state := InitialState()
+	blackTurn := state.BlackTurn // The side of the next GGF move
+	for i, move := range record.Moves {
+		if move != PASS_MOVE && state.BlackTurn != blackTurn {
+			game.Moves = append(game.Moves, GGFMove{Move: PASS_MOVE})
+			blackTurn = !blackTurn
+		}
+		ggfMove := GGFMove{Move: move}
+		if i < len(record.Stats) {
+			ggfMove.Time = record.Stats[i].Duration
+		}
+		game.Moves = append(game.Moves, ggfMove)
+		blackTurn = !blackTurn
+		if move != PASS_MOVE {
+			state.ApplyMove(move)
+		}
+	}
+	final := record.State()
+	if IsTerminalState(final) {
+		game.Result = float64(finalDiscDifferential(final.Boards.Black, final.Boards.White))
+	} else {
+		game.ResultType = "?"
+	}
+	return game
+}
+
+// States replays the moves from the start position, validating them with Board.MakeMoveIndex rules.
+// Returns the states after every move that is not a pass, with the turn passed like ApplyMove does.
+func (g *GGFGame) States() ([]State, error) {
+	board := g.Start.Boards
+	blackTurn := g.Start.BlackTurn
+	states := make([]State, 0, len(g.Moves))
+	for i, move := range g.Moves {
+		if move.Move == PASS_MOVE {
+			if board.HasValidMove(blackTurn) {
+				return nil, fmt.Errorf("%w: move %d is a pass but the player has moves", ErrInvalidGGF, i+1)
+			}
+			blackTurn = !blackTurn
+			continue
+		}
+		if err := board.TryMoveIndex(blackTurn, move.Move); err != nil {
+			return nil, fmt.Errorf("%w: move %d: %w", ErrInvalidGGF, i+1, err)
+		}
+		blackTurn = !blackTurn
+		state := State{Boards: board, BlackTurn: blackTurn}
+		if !board.HasValidMove(state.BlackTurn) && board.HasValidMove(!state.BlackTurn) {
+			state.BlackTurn = !state.BlackTurn
+		}
+		state.Hash = board.ZobristHash(state.BlackTurn)
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// String returns the game in GGF, in one line.
+func (g *GGFGame) String() string {
+	var sb strings.Builder
+	sb.WriteString("(;GM[Othello]")
+	writeGGFProperty(&sb, "PC", g.Place)
+	writeGGFProperty(&sb, "DT", g.Date)
+	writeGGFProperty(&sb, "PB", g.Black)
+	writeGGFProperty(&sb, "PW", g.White)
+	if g.BlackRating != 0 {
+		writeGGFProperty(&sb, "RB", strconv.FormatFloat(g.BlackRating, 'f', 2, 64))
+	}
+	if g.WhiteRating != 0 {
+		writeGGFProperty(&sb, "RW", strconv.FormatFloat(g.WhiteRating, 'f', 2, 64))
+	}
+	writeGGFProperty(&sb, "TI", g.TimeControl)
+	boardType := g.BoardType
+	if boardType == "" {
+		boardType = "8"
+	}
+	writeGGFProperty(&sb, "TY", boardType)
+	result := "?"
+	if g.ResultType != "?" {
+		result = fmt.Sprintf("%+.3f", g.Result)
+		if g.ResultType != "" {
+			result += ":" + g.ResultType
+		}
+	}
+	writeGGFProperty(&sb, "RE", result)
+
+	position := g.Start.Boards.PositionString()
+	var bo strings.Builder
+	bo.WriteString("8")
+	for row := 0; row < 8; row++ {
+		bo.WriteString(" ")
+		bo.WriteString(strings.ReplaceAll(position[row*8:row*8+8], "X", "*"))
+	}
+	if g.Start.BlackTurn {
+		bo.WriteString(" *")
+	} else {
+		bo.WriteString(" O")
+	}
+	writeGGFProperty(&sb, "BO", bo.String())
+
+	blackTurn := g.Start.BlackTurn
+	for _, move := range g.Moves {
+		key := "W"
+		if blackTurn {
+			key = "B"
+		}
+		text := "PA"
+		if move.Move != PASS_MOVE {
+			text = strings.ToUpper(MoveString(move.Move))
+		}
+		text += "/"
+		if move.Eval != 0 {
+			text += strconv.FormatFloat(move.Eval, 'f', 2, 64)
+		}
+		text += "/"
+		if move.Time != 0 {
+			text += strconv.FormatFloat(move.Time.Seconds(), 'f', 2, 64)
+		}
+		writeGGFProperty(&sb, key, strings.TrimRight(text, "/"))
+		blackTurn = !blackTurn
+	}
+	sb.WriteString(";)")
+	return sb.String()
+}
+
+// ggfEscaper escapes the backslashes and the closing brackets of a property value.
+var ggfEscaper = strings.NewReplacer(`\`, `\\`, "]", `\]`)
+
+// writeGGFProperty writes KEY[value], or nothing if the value is empty.
+func writeGGFProperty(sb *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	sb.WriteString(key)
+	sb.WriteByte('[')
+	ggfEscaper.WriteString(sb, value)
+	sb.WriteByte(']')
+}
+
+// WriteGGF writes the games in GGF, one per line.
+func WriteGGF(w io.Writer, games []GGFGame) error {
+	writer := bufio.NewWriter(w)
+	for i := range games {
+		writer.WriteString(games[i].String())
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
+
+// SaveGGF writes the games to a GGF file.
+func SaveGGF(path string, games []GGFGame) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteGGF(file, games); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadGGF reads the games of a GGF file.
+func LoadGGF(path string) ([]GGFGame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadGGF(file)
+}
+
+// ReadGGF reads all the games of a GGF input. Text outside of the games is ignored.
+// Every game is replayed to validate its moves.
+func ReadGGF(r io.Reader) ([]GGFGame, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	var games []GGFGame
+	for {
+		start := strings.Index(text, "(;")
+		if start < 0 {
+			return games, nil
+		}
+		game, rest, err := parseGGFGame(text[start+2:])
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", len(games)+1, err)
+		}
+		if _, err := game.States(); err != nil {
+			return nil, fmt.Errorf("game %d: %w", len(games)+1, err)
+		}
+		games = append(games, game)
+		text = rest
+	}
+}
+
+// ParseGGF returns the game of a GGF string.
+func ParseGGF(text string) (GGFGame, error) {
+	games, err := ReadGGF(strings.NewReader(text))
+	if err != nil {
+		return GGFGame{}, err
+	}
+	if len(games) != 1 {
+		return GGFGame{}, fmt.Errorf("%w: %d games, want 1", ErrInvalidGGF, len(games))
+	}
+	return games[0], nil
+}
+
+// parseGGFGame parses the properties of a game after its "(;" and returns the text after its ";)".
+func parseGGFGame(text string) (GGFGame, string, error) {
+	game := GGFGame{BoardType: "8", Start: InitialState(), ResultType: "?"}
+	for {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if strings.HasPrefix(text, ";)") {
+			return game, text[2:], nil
+		}
+		keyEnd := strings.IndexByte(text, '[')
+		if keyEnd <= 0 {
+			return game, "", fmt.Errorf("%w: expected a property or ;)", ErrInvalidGGF)
+		}
+		key := text[:keyEnd]
+		var value strings.Builder
+		i := keyEnd + 1
+		for ; i < len(text) && text[i] != ']'; i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+			}
+			value.WriteByte(text[i])
+		}
+		if i == len(text) {
+			return game, "", fmt.Errorf("%w: property %s is not closed", ErrInvalidGGF, key)
+		}
+		text = text[i+1:]
+		if err := game.setProperty(key, value.String()); err != nil {
+			return game, "", err
+		}
+	}
+}
+
+// setProperty sets the field of the game of a property.
+func (g *GGFGame) setProperty(key, value string) error {
+	var err error
+	switch key {
+	case "GM":
+		if !strings.EqualFold(value, "Othello") {
+			err = fmt.Errorf("%w: game %q is not Othello", ErrInvalidGGF, value)
+		}
+	case "PC":
+		g.Place = value
+	case "DT":
+		g.Date = value
+	case "PB":
+		g.Black = value
+	case "PW":
+		g.White = value
+	case "RB":
+		g.BlackRating, err = strconv.ParseFloat(value, 64)
+	case "RW":
+		g.WhiteRating, err = strconv.ParseFloat(value, 64)
+	case "TI":
+		g.TimeControl = value
+	case "TY":
+		g.BoardType = value
+		if ggfBoardSize(value) != "8" {
+			err = fmt.Errorf("%w: board type %q is not 8x8", ErrInvalidGGF, value)
+		}
+	case "RE":
+		err = g.parseResult(value)
+	case "BO":
+		err = g.parseBoard(value)
+	case "B", "W":
+		// The passes are explicit, so the sides alternate from the start position (BO comes before the moves)
+		blackTurn := g.Start.BlackTurn == (len(g.Moves)%2 == 0)
+		if (key == "B") != blackTurn {
+			return fmt.Errorf("%w: move %d %s[%s] is not of the side to move", ErrInvalidGGF, len(g.Moves)+1, key, value)
+		}
+		var move GGFMove
+		move, err = parseGGFMove(value)
+		g.Moves = append(g.Moves, move)
+	}
+	if err != nil && !errors.Is(err, ErrInvalidGGF) {
+		err = fmt.Errorf("%w: %s[%s]: %v", ErrInvalidGGF, key, value, err)
+	}
+	return err
+}
+
+// ggfBoardSize returns the size in a board type, like 8 in s8r18 (synchro, random start with 18 disks).
+func ggfBoardSize(boardType string) string {
+	size := strings.TrimLeft(boardType, "abcdefghijklmnopqrstuvwxyz")
+	end := 0
+	for end < len(size) && size[end] >= '0' && size[end] <= '9' {
+		end++
+	}
+	return size[:end]
+}
+
+// parseResult parses RE, like +12.000 or -2.000:r.
+func (g *GGFGame) parseResult(value string) error {
+	if value == "?" {
+		g.Result, g.ResultType = 0, "?"
+		return nil
+	}
+	score, resultType, _ := strings.Cut(value, ":")
+	result, err := strconv.ParseFloat(score, 64)
+	if err != nil {
+		return err
+	}
+	g.Result, g.ResultType = result, resultType
+	return nil
+}
+
+// parseBoard parses BO, the board size followed by the squares and the side to move.
+func (g *GGFGame) parseBoard(value string) error {
+	size, position, found := strings.Cut(strings.TrimSpace(value), " ")
+	if !found || size != "8" {
+		return fmt.Errorf("%w: board %q is not 8x8", ErrInvalidGGF, value)
+	}
+	position = strings.TrimSpace(position)
+	state, err := ParsePosition(position)
+	if err != nil {
+		return err
+	}
+	// ParsePosition passes the turn if needed, but GGF writes the pass as a move
+	side := position[len(position)-1]
+	state.BlackTurn = side == '*' || side == 'X' || side == 'x' || side == 'B' || side == 'b'
+	state.Hash = state.Boards.ZobristHash(state.BlackTurn)
+	g.Start = state
+	return nil
+}
+
+// parseGGFMove parses a move with its optional evaluation and time, like f5/-1.50/2.31.
+func parseGGFMove(value string) (GGFMove, error) {
+	fields := strings.Split(value, "/")
+	var move GGFMove
+	var err error
+	if move.Move, err = ParseMove(fields[0]); err != nil {
+		return move, err
+	}
+	if len(fields) > 1 && fields[1] != "" {
+		if move.Eval, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return move, err
+		}
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		if move.Time, err = parseGGFTime(fields[2]); err != nil {
+			return move, err
+		}
+	}
+	return move, nil
+}
+
+// parseGGFTime parses a time in seconds, minutes:seconds or hours:minutes:seconds.
+func parseGGFTime(text string) (time.Duration, error) {
+	var seconds float64
+	for _, part := range strings.Split(text, ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds = seconds*60 + value
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
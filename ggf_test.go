@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParseGGF(t *testing.T) {
+	text := "(;GM[Othello]PC[GGS/os]DT[2003.12.15_13:24:03.MET]PB[player1]PW[player2]RB[2197.72]RW[2199.38]" +
+		"TI[15:00//02:00]TY[8]RE[-4.000:r]" +
+		"BO[8 -------- -------- -------- ---O*--- ---*O--- -------- -------- -------- *]" +
+		"B[F5//0.01]W[d6/-1.50/2.31]B[c3/1.00/1:02];)"
+	game, err := ParseGGF(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Black != "player1" || game.White != "player2" || game.WhiteRating != 2199.38 || game.TimeControl != "15:00//02:00" {
+		t.Errorf("wrong header: %+v", game)
+	}
+	if game.Result != -4 || game.ResultType != "r" {
+		t.Errorf("result = %v:%s, want -4:r", game.Result, game.ResultType)
+	}
+	if game.Start != InitialState() {
+		t.Errorf("start = %s, want the initial position", game.Start.PositionString())
+	}
+	want := []GGFMove{
+		{Move: 37, Time: 10 * time.Millisecond},
+		{Move: 43, Eval: -1.5, Time: 2310 * time.Millisecond},
+		{Move: 18, Eval: 1, Time: 62 * time.Second},
+	}
+	if len(game.Moves) != len(want) {
+		t.Fatalf("moves = %+v, want %+v", game.Moves, want)
+	}
+	for i := range want {
+		if game.Moves[i] != want[i] {
+			t.Errorf("move %d = %+v, want %+v", i+1, game.Moves[i], want[i])
+		}
+	}
+	states, err := game.States()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 3 || states[2].BlackTurn {
+		t.Errorf("States() = %d states, white to move %v", len(states), !states[len(states)-1].BlackTurn)
+	}
+
+	for _, invalid := range []string{
+		"(;GM[Chess]TY[8];)",
+		"(;GM[Othello]TY[10];)",
+		"(;GM[Othello]B[f5]B[f5];)",
+		"(;GM[Othello]B[PA];)",
+		"(;GM[Othello]B[f5/x];)",
+		"(;GM[Othello]B[f5",
+		"(;GM[Othello]W[f5];)",           // Black is to move
+		"(;GM[Othello]B[f5]B[f6]W[PA];)", // Black cannot move twice, even if white passes after
+		"(;GM[Othello]BO[8 -------- -------- -------- ---O*--- ---*O--- -------- -------- -------- O]B[f4];)",
+	} {
+		if _, err := ParseGGF(invalid); !errors.Is(err, ErrInvalidGGF) {
+			t.Errorf("ParseGGF(%q) error = %v, want ErrInvalidGGF", invalid, err)
+		}
+	}
+}
+
+func TestGGFRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	games := make([]GGFGame, 50)
+	for i := range games {
+		games[i] = GGFFromRecord(randomGameRecord(rng))
+		games[i].Date = "2024.01.01_00:00:00.UTC"
+	}
+	var buf bytes.Buffer
+	if err := WriteGGF(&buf, games); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadGGF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(games) {
+		t.Fatalf("loaded %d games, want %d", len(loaded), len(games))
+	}
+	for i := range games {
+		got, want := loaded[i], games[i]
+		if got.Black != want.Black || got.Date != want.Date || got.Result != want.Result || got.Start != want.Start {
+			t.Errorf("game %d header changed:\n%+v\n%+v", i, got, want)
+		}
+		if len(got.Moves) != len(want.Moves) {
+			t.Fatalf("game %d has %d moves, want %d", i, len(got.Moves), len(want.Moves))
+		}
+		for j := range want.Moves {
+			if got.Moves[j].Move != want.Moves[j].Move || (got.Moves[j].Time-want.Moves[j].Time).Abs() > 10*time.Millisecond {
+				t.Errorf("game %d move %d = %+v, want %+v", i, j+1, got.Moves[j], want.Moves[j])
+			}
+		}
+		states, err := got.States()
+		if err != nil {
+			t.Fatal(err)
+		}
+		final := states[len(states)-1]
+		if !IsTerminalState(final) || float64(finalDiscDifferential(final.Boards.Black, final.Boards.White)) != got.Result {
+			t.Errorf("game %d replay ends in %s, result %v", i, final.PositionString(), got.Result)
+		}
+	}
+}
+
+func TestGGFFromRecordResultWithEmpties(t *testing.T) {
+	// A random game that ends before the board is full, the empty squares go to the winner
+	rng := rand.New(rand.NewSource(1))
+	record := randomGameRecord(rng)
+	final := record.State()
+	for tries := 0; final.Boards.EmptySquares() == 0 || record.Score[0] == record.Score[1]; tries++ {
+		if tries == 100000 {
+			t.Fatal("no random game ended with empty squares")
+		}
+		record = randomGameRecord(rng)
+		final = record.State()
+	}
+	game := GGFFromRecord(record)
+	if want := float64(finalDiscDifferential(final.Boards.Black, final.Boards.White)); game.Result != want || game.ResultType != "" {
+		t.Errorf("result %v:%s with %d empties, want %v", game.Result, game.ResultType, final.Boards.EmptySquares(), want)
+	}
+}
+
+func TestGGFFromRecordWritesThePasses(t *testing.T) {
+	// A record can leave the passes out, GGF writes them so that the sides alternate
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		record := randomGameRecord(rng)
+		var moves []uint8
+		for _, move := range record.Moves {
+			if move != PASS_MOVE {
+				moves = append(moves, move)
+			}
+		}
+		withPasses := GGFFromRecord(record)
+		record.Moves = moves
+		game := GGFFromRecord(record)
+		if len(game.Moves) != len(withPasses.Moves) {
+			t.Fatalf("%d moves without the passes of the record, %d with them", len(game.Moves), len(withPasses.Moves))
+		}
+		if _, err := ParseGGF(game.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGGFEscapesNames(t *testing.T) {
+	game := GGFGame{Black: `back\slash]`, White: `\]\`, Start: InitialState(), ResultType: "?"}
+	parsed, err := ParseGGF(game.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Black != game.Black || parsed.White != game.White {
+		t.Errorf("names %q and %q come back as %q and %q", game.Black, game.White, parsed.Black, parsed.White)
+	}
+}
@@ -4,7 +4,10 @@ go 1.24.0
 
 toolchain go1.24.10
 
-require github.com/hajimehoshi/ebiten/v2 v2.9.4
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/hajimehoshi/ebiten/v2 v2.9.4
+)
 
 require (
 	github.com/ebitengine/gomobile v0.0.0-20250923094054-ea854a63cce1 // indirect
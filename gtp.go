@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GTP (Go Text Protocol) style engine mode, so generic match runners can drive the engine.
+// Every command is one line, optionally starting with a numeric id, and every answer is
+// "=[id] result" or "?[id] error" followed by an empty line. The commands are:
+//
+//	protocol_version, name, version, known_command <cmd>, list_commands, quit
+//	boardsize 8                       only the 8x8 board exists
+//	clear_board                       start a new game
+//	komi <x>                          accepted and ignored
+//	play <color> <move>               color is b/black/w/white, move like d3 or pass
+//	genmove <color>                   the engine plays and answers its move (pass if it has none)
+//	undo                              take back the last move
+//	showboard                         the board as PrintBoard draws it
+//	final_score                       B+n, W+n or 0, with the empty squares going to the winner
+//	time_settings <main> <byo> <n>    main time and n stones per byo-yomi period, in seconds
+//	time_left <color> <time> <n>      the time remaining for a color
+//
+// Passes are automatic inside the engine (the tree nodes skip the turn), so playing a pass
+// only checks that the color has no moves. With Ponder the engine keeps searching after genmove
+// until the next command arrives.
+
+// GTPEngine keeps the game, the search settings and the clocks of a GTP session.
+type GTPEngine struct {
+	Name       string
+	Engine     Engine // Plays the game, see Engines
+	Iterations int    // Iterations of every search without time settings
+	Ponder     bool   // Search on the time of the opponent
+
+	TimeManager   *TimeManager // Splits the main time between the moves
+	MainTime      time.Duration
+	ByoYomiTime   time.Duration
+	ByoYomiStones int
+	timeLeft      [2]time.Duration // Position 0 is black, position 1 is white
+	stonesLeft    [2]int           // Moves to play in the current byo-yomi period (0 during the main time)
+
+	history  []State // States before every move, for undo
+	ponderer *Ponderer
+	rng      *rand.Rand // Chooses between symmetric moves, see genmove
+	out      io.Writer
+}
+
+// gtpCommands are the commands known by GTPEngine, in the order of list_commands.
+var gtpCommands = []string{
+	"protocol_version", "name", "version", "known_command", "list_commands", "quit",
+	"boardsize", "clear_board", "komi", "play", "genmove", "undo", "showboard", "final_score",
+	"time_settings", "time_left",
+}
+
+// NewGTPEngine returns an engine that plays with the DEFAULT_ENGINE and writes its answers to out.
+func NewGTPEngine(out io.Writer, rng *rand.Rand) *GTPEngine {
+	return &GTPEngine{
+		Name:        "othello-mcts",
+		Engine:      NewEngine(DEFAULT_ENGINE, rng),
+		Iterations:  1000,
+		TimeManager: NewTimeManager(),
+		rng:         NewStreamRNG(rng.Int63(), 0),
+		out:         out,
+	}
+}
+
+// RunGTP reads GTP commands from in until quit or the end of the input.
+func RunGTP(in io.Reader, engine *GTPEngine) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if engine.HandleCommand(scanner.Text()) {
+			return nil
+		}
+	}
+	if engine.ponderer != nil {
+		engine.ponderer.Stop()
+	}
+	return scanner.Err()
+}
+
+// HandleCommand runs one GTP command and writes its answer. Returns true if the command is quit.
+func (e *GTPEngine) HandleCommand(line string) bool {
+	if comment := strings.IndexByte(line, '#'); comment >= 0 {
+		line = line[:comment]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	id := ""
+	if _, err := strconv.Atoi(fields[0]); err == nil {
+		id, fields = fields[0], fields[1:]
+		if len(fields) == 0 {
+			e.answer(id, "", fmt.Errorf("missing command"))
+			return false
+		}
+	}
+	if e.ponderer != nil {
+		e.ponderer.Stop() // Every command can use the engine
+	}
+	result, err := e.run(fields[0], fields[1:])
+	e.answer(id, result, err)
+	if e.Ponder && err == nil && fields[0] == "genmove" {
+		if e.ponderer == nil || e.ponderer.engine != e.Engine {
+			e.ponderer = NewPonderer(e.Engine)
+		}
+		e.ponderer.Start()
+	}
+	return err == nil && fields[0] == "quit"
+}
+
+// answer writes a success (=) or failure (?) answer followed by the empty line.
+func (e *GTPEngine) answer(id, result string, err error) {
+	if err != nil {
+		fmt.Fprintf(e.out, "?%s %v\n\n", id, err)
+		return
+	}
+	fmt.Fprintf(e.out, "=%s %s\n\n", id, result)
+}
+
+// run executes a command and returns its result.
+func (e *GTPEngine) run(command string, args []string) (string, error) {
+	switch command {
+	case "protocol_version":
+		return "2", nil
+	case "name":
+		return e.Name, nil
+	case "version":
+		return "1", nil
+	case "known_command":
+		if len(args) == 0 {
+			return "", fmt.Errorf("missing command")
+		}
+		for _, known := range gtpCommands {
+			if args[0] == known {
+				return "true", nil
+			}
+		}
+		return "false", nil
+	case "list_commands":
+		return strings.Join(gtpCommands, "\n"), nil
+	case "quit", "komi":
+		return "", nil
+	case "boardsize":
+		if len(args) == 0 || args[0] != "8" {
+			return "", fmt.Errorf("unacceptable size")
+		}
+		return "", nil
+	case "clear_board":
+		e.Engine.NewGame()
+		e.history = e.history[:0]
+		e.timeLeft = [2]time.Duration{e.MainTime, e.MainTime}
+		e.stonesLeft = [2]int{}
+		return "", nil
+	case "play":
+		return "", e.play(args)
+	case "genmove":
+		return e.genmove(args)
+	case "undo":
+		if len(e.history) == 0 {
+			return "", fmt.Errorf("cannot undo")
+		}
+		e.Engine.Reset(e.history[len(e.history)-1])
+		e.history = e.history[:len(e.history)-1]
+		return "", nil
+	case "showboard":
+		var sb strings.Builder
+		state := e.Engine.State()
+		state.Boards.FprintBoard(&sb)
+		return strings.TrimRight(sb.String(), "\n"), nil
+	case "final_score":
+		state := e.Engine.State()
+		score := finalDiscDifferential(state.Boards.Black, state.Boards.White)
+		switch {
+		case score > 0:
+			return fmt.Sprintf("B+%d", score), nil
+		case score < 0:
+			return fmt.Sprintf("W+%d", -score), nil
+		}
+		return "0", nil
+	case "time_settings":
+		return "", e.timeSettings(args)
+	case "time_left":
+		return "", e.updateTimeLeft(args)
+	}
+	return "", fmt.Errorf("unknown command")
+}
+
+// parseGTPColor returns true for black and false for white.
+func parseGTPColor(text string) (bool, error) {
+	switch strings.ToLower(text) {
+	case "b", "black":
+		return true, nil
+	case "w", "white":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid color %q", text)
+}
+
+// play handles play <color> <move>.
+func (e *GTPEngine) play(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("syntax error")
+	}
+	forBlack, err := parseGTPColor(args[0])
+	if err != nil {
+		return err
+	}
+	move, err := ParseMove(args[1])
+	if err != nil {
+		return err
+	}
+	state := e.Engine.State()
+	if move == PASS_MOVE {
+		if state.Boards.HasValidMove(forBlack) {
+			return fmt.Errorf("illegal move: the player has moves")
+		}
+		return nil // The turn was already passed
+	}
+	if state.BlackTurn != forBlack {
+		return fmt.Errorf("illegal move: %w", ErrWrongTurn)
+	}
+	if err := e.Engine.Play(move); err != nil {
+		return fmt.Errorf("illegal move: %w", err)
+	}
+	e.history = append(e.history, state)
+	return nil
+}
+
+// genmove handles genmove <color>: it searches, plays the chosen move and returns it.
+func (e *GTPEngine) genmove(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("syntax error")
+	}
+	forBlack, err := parseGTPColor(args[0])
+	if err != nil {
+		return "", err
+	}
+	state := e.Engine.State()
+	if !state.Boards.HasValidMove(forBlack) {
+		return "pass", nil
+	}
+	if state.BlackTurn != forBlack {
+		return "", ErrWrongTurn
+	}
+
+	start := time.Now()
+	color := 1
+	if forBlack {
+		color = 0
+	}
+	byoYomiShare := time.Duration(0)
+	if e.ByoYomiTime > 0 && e.ByoYomiStones > 0 {
+		byoYomiShare = e.ByoYomiTime / time.Duration(e.ByoYomiStones)
+	}
+	var best uint8
+	switch {
+	case e.stonesLeft[color] > 0:
+		// During byo-yomi the time left is split between the stones left
+		best, _ = e.Engine.BestMove(context.Background(), Limits{Deadline: start.Add(e.timeLeft[color] / time.Duration(e.stonesLeft[color]))})
+	case e.timeLeft[color] > 0 || byoYomiShare > 0:
+		// The time manager splits the main time, a byo-yomi share is like an increment
+		best, _ = e.Engine.BestMoveOnClock(context.Background(), e.TimeManager, e.timeLeft[color], byoYomiShare)
+	default:
+		best, _ = e.Engine.BestMove(context.Background(), Limits{Iterations: e.Iterations})
+	}
+	if e.timeLeft[color] > 0 {
+		e.timeLeft[color] -= time.Since(start)
+	}
+	// The search only keeps one move of every group of symmetric moves (the same game),
+	// any of them is played so that the games do not always start the same way
+	if symmetric := state.Boards.SymmetricMoves(best); len(symmetric) > 1 && e.rng != nil {
+		best = symmetric[e.rng.Intn(len(symmetric))]
+	}
+
+	if err := e.Engine.Play(best); err != nil {
+		return "", err
+	}
+	e.history = append(e.history, state)
+	return MoveString(best), nil
+}
+
+// timeSettings handles time_settings <main time> <byo-yomi time> <byo-yomi stones>.
+func (e *GTPEngine) timeSettings(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("syntax error")
+	}
+	mainTime, err1 := strconv.Atoi(args[0])
+	byoYomiTime, err2 := strconv.Atoi(args[1])
+	stones, err3 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil || err3 != nil || mainTime < 0 || byoYomiTime < 0 || stones < 0 {
+		return fmt.Errorf("syntax error")
+	}
+	e.MainTime = time.Duration(mainTime) * time.Second
+	e.ByoYomiTime = time.Duration(byoYomiTime) * time.Second
+	e.ByoYomiStones = stones
+	e.timeLeft = [2]time.Duration{e.MainTime, e.MainTime}
+	e.stonesLeft = [2]int{}
+	return nil
+}
+
+// updateTimeLeft handles time_left <color> <time> <stones>.
+func (e *GTPEngine) updateTimeLeft(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("syntax error")
+	}
+	forBlack, err := parseGTPColor(args[0])
+	if err != nil {
+		return err
+	}
+	seconds, err := strconv.Atoi(args[1])
+	if err != nil || seconds < 0 {
+		return fmt.Errorf("syntax error")
+	}
+	stones := 0
+	if len(args) > 2 {
+		if stones, err = strconv.Atoi(args[2]); err != nil || stones < 0 {
+			return fmt.Errorf("syntax error")
+		}
+	}
+	color := 1
+	if forBlack {
+		color = 0
+	}
+	e.timeLeft[color] = time.Duration(seconds) * time.Second
+	e.stonesLeft[color] = stones
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// gtpClient drives an engine running RunGTP over in-process pipes.
+type gtpClient struct {
+	t       *testing.T
+	toEng   *io.PipeWriter
+	fromEng *bufio.Scanner
+	done    chan error
+}
+
+func newGTPClient(t *testing.T, seed int64) *gtpClient {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	rng := rand.New(rand.NewSource(seed))
+	engine := NewGTPEngine(outWriter, rng)
+	engine.Engine = NewEngine("puct", rng)
+	engine.Iterations = 50
+	client := &gtpClient{t: t, toEng: inWriter, fromEng: bufio.NewScanner(outReader), done: make(chan error, 1)}
+	go func() {
+		err := RunGTP(inReader, engine)
+		outWriter.Close()
+		client.done <- err
+	}()
+	return client
+}
+
+// command sends a command and returns the answer without the = or ? (and the id) and whether it succeeded.
+func (c *gtpClient) command(command string) (string, bool) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.toEng, command+"\n"); err != nil {
+		c.t.Fatal(err)
+	}
+	var lines []string
+	for c.fromEng.Scan() && c.fromEng.Text() != "" {
+		lines = append(lines, c.fromEng.Text())
+	}
+	if len(lines) == 0 {
+		c.t.Fatalf("no answer to %q", command)
+	}
+	answer := strings.Join(lines, "\n")
+	return strings.TrimSpace(strings.TrimLeft(answer[1:], "0123456789")), answer[0] == '='
+}
+
+// mustCommand sends a command that must succeed and returns its answer.
+func (c *gtpClient) mustCommand(command string) string {
+	c.t.Helper()
+	answer, ok := c.command(command)
+	if !ok {
+		c.t.Fatalf("%q failed: %s", command, answer)
+	}
+	return answer
+}
+
+func TestGTPCommands(t *testing.T) {
+	c := newGTPClient(t, 1)
+	if answer := c.mustCommand("1 protocol_version"); answer != "2" {
+		t.Errorf("protocol_version = %q", answer)
+	}
+	if answer := c.mustCommand("known_command genmove"); answer != "true" {
+		t.Errorf("known_command genmove = %q", answer)
+	}
+	if _, ok := c.command("boardsize 10"); ok {
+		t.Error("boardsize 10 accepted")
+	}
+	c.mustCommand("boardsize 8")
+	c.mustCommand("clear_board")
+	c.mustCommand("play b d3")
+	if _, ok := c.command("play b c3"); ok {
+		t.Error("black played twice")
+	}
+	if _, ok := c.command("play w a1"); ok {
+		t.Error("illegal move accepted")
+	}
+	if _, ok := c.command("play w pass"); ok {
+		t.Error("pass accepted with legal moves")
+	}
+	afterD3 := InitialState()
+	afterD3.ApplyMove(19)
+	board := c.mustCommand("showboard")
+	if !strings.Contains(board, "Position: "+afterD3.Boards.PositionString()) {
+		t.Errorf("showboard after d3:\n%s", board)
+	}
+	c.mustCommand("undo")
+	if answer := c.mustCommand("final_score"); answer != "0" {
+		t.Errorf("final_score of the start position = %q", answer)
+	}
+	if _, ok := c.command("undo"); ok {
+		t.Error("undo with no moves accepted")
+	}
+	if _, ok := c.command("foo"); ok {
+		t.Error("unknown command accepted")
+	}
+	openings := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		c.mustCommand("clear_board")
+		openings[c.mustCommand("genmove b")] = true
+	}
+	if len(openings) < 2 {
+		t.Errorf("genmove always opens with %v, any of the symmetric moves can be played", openings)
+	}
+	c.mustCommand("time_settings 60 0 0")
+	c.mustCommand("time_left b 30 0")
+	c.mustCommand("quit")
+	if err := <-c.done; err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGTPMatch plays a whole game between two engines, like a match runner would.
+func TestGTPMatch(t *testing.T) {
+	players := [2]*gtpClient{newGTPClient(t, 1), newGTPClient(t, 2)}
+	record := NewGameRecord(PlayerInfo{Name: "gtp 1"}, PlayerInfo{Name: "gtp 2"})
+	passes := 0
+	for turn := 0; passes < 2; turn = 1 - turn {
+		color := "b"
+		if turn == 1 {
+			color = "w"
+		}
+		answer := players[turn].mustCommand("genmove " + color)
+		players[1-turn].mustCommand("play " + color + " " + answer)
+		if answer == "pass" {
+			passes++
+			continue
+		}
+		passes = 0
+		move, err := ParseMove(answer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := record.TryPlay(move, MoveStats{}); err != nil {
+			t.Fatalf("genmove %s answered %s: %v", color, answer, err)
+		}
+	}
+	if final := record.State(); !IsTerminalState(final) {
+		t.Fatalf("the engines passed before the end: %s", final.PositionString())
+	}
+	score := players[0].mustCommand("final_score")
+	if other := players[1].mustCommand("final_score"); other != score {
+		t.Errorf("final_score %s and %s", score, other)
+	}
+	for _, player := range players {
+		player.mustCommand("quit")
+	}
+}
@@ -1,29 +1,39 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
 // PrintBoard prints the board in a readable 8×8 grid.
 func (b *Board) PrintBoard() {
-	fmt.Println()
-	fmt.Println("    a b c d e f g h")
-	fmt.Println("   -----------------")
+	b.FprintBoard(os.Stdout)
+}
+
+// FprintBoard writes the board like PrintBoard to w.
+func (b *Board) FprintBoard(w io.Writer) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "    a b c d e f g h")
+	fmt.Fprintln(w, "   -----------------")
 	for row := 0; row < 8; row++ {
-		fmt.Printf("%d | ", row+1)
+		fmt.Fprintf(w, "%d | ", row+1)
 		for col := 0; col < 8; col++ {
 			switch b.CellState(row, col) {
 			case CELL_BLACK:
-				fmt.Print("@ ")
+				fmt.Fprint(w, "@ ")
 			case CELL_WHITE:
-				fmt.Print("o ")
+				fmt.Fprint(w, "o ")
 			default:
-				fmt.Print(". ")
+				fmt.Fprint(w, ". ")
 			}
 		}
-		fmt.Printf("| %d\n", row+1)
+		fmt.Fprintf(w, "| %d\n", row+1)
 	}
-	fmt.Println("   -----------------")
-	fmt.Println("    a b c d e f g h")
-	fmt.Println()
+	fmt.Fprintln(w, "   -----------------")
+	fmt.Fprintln(w, "    a b c d e f g h")
+	fmt.Fprintln(w, "Position:", b.PositionString())
+	fmt.Fprintln(w)
 }
 
 // PrintBoardWithMoves prints the board and shows all possible legal moves
@@ -67,40 +77,55 @@ func (s *State) PrintBoardWithMoves() {
 	}
 	fmt.Println("   -----------------")
 	fmt.Println("    a b c d e f g h")
+	fmt.Println("Position:", s.PositionString())
 
 	// Now print the moves in input format
-	arr := ArrayOfPositionalMoves(ArrayOfMoves(legalMoves))
-	if len(arr) == 0 {
+	moves := FastArrayOfMoves(legalMoves)
+	if len(moves) == 0 {
 		fmt.Println("\nNo legal moves available.")
 		return
 	}
 
 	fmt.Println("\nPossible moves:")
-	for _, m := range arr {
-		row := m[0]
-		col := m[1]
-		fmt.Printf("  %c%d -> enter as: %c%d or \"%d %d\"\n",
-			'a'+rune(col), row+1, 'a'+rune(col), row+1, row, col)
+	for _, m := range moves {
+		fmt.Printf("  %s\n", MoveString(m))
 	}
 	fmt.Println()
 }
 
-func RequestMove(userIsBlack bool) [2]uint8 {
-	var arr [2]uint8
-
+// RequestMove asks the user for a move (like d3) until a valid one for the player in turn is entered.
+// Returns the index of the move.
+func RequestMove(state State) uint8 {
 	color := "white"
-	if userIsBlack {
+	if state.BlackTurn {
 		color = "black"
 	}
 
-	fmt.Printf("Enter your move %s (e.g., 6 7): ", color)
-	_, err := fmt.Scanf("%d %d", &arr[0], &arr[1])
-	if err != nil {
-		fmt.Println("Error while scanning:", err)
-		panic(err)
+	for {
+		var text string
+		fmt.Printf("Enter your move %s (e.g., d3): ", color)
+		_, err := fmt.Scanln(&text)
+		if err != nil {
+			fmt.Println("Error while scanning:", err)
+			continue
+		}
+		move, err := ParseMove(text)
+		if err != nil {
+			fmt.Println("Invalid move:", err)
+			continue
+		}
+		if move == PASS_MOVE {
+			fmt.Println("Invalid move: you can only pass when you have no moves, and then it is done for you")
+			continue
+		}
+		fmt.Println("You entered:", MoveString(move))
+		board := state.Boards // Copy, we only want to check the move
+		if err := board.TryMoveIndex(state.BlackTurn, move); err != nil {
+			fmt.Println("Invalid move:", err)
+			continue
+		}
+		return move
 	}
-	fmt.Println("You entered:", arr)
-	return arr
 }
 
 func RequestUserIsBlack() bool {
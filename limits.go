@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Limits are the limits of a search, the search stops as soon as any of them is reached
+// or its context is cancelled. A zero field is no limit, so with no limits at all the search
+// runs until the context is cancelled. At least one playout always runs, so there is always a best move.
+// When the exact solver takes over (see EndgameEmpties) it stops at the Deadline, at MaxNodes positions
+// or when the context is cancelled, and the search falls back to MCTS if the solve did not finish.
+type Limits struct {
+	Iterations int       // Playouts of the search (per routine for the parallel searches)
+	Deadline   time.Time // Wall-clock time at which the search stops
+	MaxNodes   int       // Nodes the search may add to the trees (of all the routines), bounds the memory used
+	NoSolver   bool      // Search with MCTS even when the exact solver could take over
+}
+
+// solves returns true if the search hands the state over to the exact solver.
+func (limits Limits) solves(state State) bool {
+	return !limits.NoSolver && ShouldSolve(state)
+}
+
+// SEARCH_CHECK_INTERVAL is the number of playouts between checks of the deadline and the context.
+const SEARCH_CHECK_INTERVAL = 16
+
+// searchLimiter counts the playouts and the new nodes of a search and tells when its limits are reached.
+type searchLimiter struct {
+	ctx      context.Context
+	limits   Limits
+	playouts int
+	nodes    int
+}
+
+// perRoutine returns the limits of every routine of a parallel search with that many routines,
+// MaxNodes is split between them so that it bounds the whole search.
+func (limits Limits) perRoutine(routines int) Limits {
+	if limits.MaxNodes > 0 {
+		limits.MaxNodes = max(limits.MaxNodes/routines, 1)
+	}
+	return limits
+}
+
+// newSearchLimiter returns the limiter of a search that has not started.
+func newSearchLimiter(ctx context.Context, limits Limits) searchLimiter {
+	return searchLimiter{ctx: ctx, limits: limits}
+}
+
+// next returns true if another playout can run.
+// The clock and the context are only checked every SEARCH_CHECK_INTERVAL playouts, they are slower than a counter.
+func (l *searchLimiter) next() bool {
+	switch {
+	case l.playouts == 0:
+		return true
+	case l.limits.Iterations > 0 && l.playouts >= l.limits.Iterations:
+		return false
+	case l.limits.MaxNodes > 0 && l.nodes >= l.limits.MaxNodes:
+		return false
+	case (l.playouts-1)%SEARCH_CHECK_INTERVAL != 0: // Checked after the first playout and then every interval
+		return true
+	case !l.limits.Deadline.IsZero() && !time.Now().Before(l.limits.Deadline):
+		return false
+	}
+	return l.ctx.Err() == nil
+}
+
+// played records a playout that added nodes to the tree.
+func (l *searchLimiter) played(nodes int) {
+	l.playouts++
+	l.nodes += nodes
+}
+
+// newNodes returns the number of nodes added by expanding the selected node (1 if the expansion returned a child).
+func newNodes[T comparable](selected, expanded T) int {
+	if selected == expanded {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSearchLimitsIterationsAndNodes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	root := InitialRootPUCTNode()
+	if _, playouts := RootAfterMCTSPUCTContext(context.Background(), root, Limits{Iterations: 300}, rng); playouts != 300 || root.Visits != 300 {
+		t.Errorf("300 iterations ran %d playouts, root visits %d", playouts, root.Visits)
+	}
+
+	root = InitialRootPUCTNode()
+	_, playouts := RootAfterMCTSPUCTContext(context.Background(), root, Limits{MaxNodes: 50}, rng)
+	if nodes := countPUCTNodes(root) - 1; nodes != 50 {
+		t.Errorf("MaxNodes 50 added %d nodes in %d playouts", nodes, playouts)
+	}
+
+	node := InitialRootNode()
+	if _, playouts := NewSearchPool(0, rng).SingleRunParallelizationMCTSContext(context.Background(), node, Limits{Iterations: 40}, rng); playouts != (searchWorkers()+1)*40 { // The workers and the master
+		t.Errorf("root parallel search with 40 iterations per routine ran %d playouts", playouts)
+	}
+}
+
+func TestSearchLimitsNodesOfAllRoutines(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pool := NewSearchPool(3, rng)
+	root := InitialRootPUCTNode()
+	pool.SingleRunParallelizationMCTSPUCTContext(context.Background(), root, Limits{MaxNodes: 200}, rng)
+	nodes := countPUCTNodes(root) - 1
+	for _, worker := range pool.workers {
+		nodes += countPUCTNodes(worker.rootPUCT) - 1
+	}
+	if nodes > 200 {
+		t.Errorf("root parallel search with MaxNodes 200 added %d nodes", nodes)
+	}
+
+	root = InitialRootPUCTNode()
+	TreeParallelizationMCTSPUCTContext(context.Background(), root, Limits{MaxNodes: 200}, rng)
+	if nodes := countPUCTNodes(root) - 1; nodes > 200 {
+		t.Errorf("tree parallel search with MaxNodes 200 added %d nodes", nodes)
+	}
+}
+
+func TestSearchLimitsDeadline(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	start := time.Now()
+	best, playouts := NewSearchPool(0, rng).SingleRunParallelizationMCTSPUCTContext(context.Background(), InitialRootPUCTNode(), Limits{Deadline: start.Add(50 * time.Millisecond)}, rng)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("50ms search took %s", elapsed)
+	}
+	if best == nil || playouts == 0 {
+		t.Errorf("search with a deadline = %v, %d playouts", best, playouts)
+	}
+}
+
+func TestSearchLimitsContext(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// At least one playout runs, so there is a move even if the search is cancelled before it starts
+	best, playouts := OriginalMonteCarloTreeSearchContext(ctx, InitialRootNode(), Limits{}, rng)
+	if best == nil || playouts != 1 {
+		t.Errorf("cancelled search = %v, %d playouts", best, playouts)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	bestPUCT, playouts := MonteCarloTreeSearchPUCTContext(ctx, InitialRootPUCTNode(), Limits{}, rng)
+	if elapsed := time.Since(start); elapsed > time.Second || bestPUCT == nil || playouts <= 1 {
+		t.Errorf("search until the context timeout = %v, %d playouts in %s", bestPUCT, playouts, elapsed)
+	}
+}
+
+// countPUCTNodes returns the number of nodes of the tree.
+func countPUCTNodes(node *PUCTNode) int {
+	count := 1
+	for _, child := range node.Children {
+		count += countPUCTNodes(child)
+	}
+	return count
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"image/color"
 	"math/rand"
-	"runtime"
+	"os"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
@@ -14,7 +15,8 @@ import (
 const (
 	ScreenWidth  = 420
 	ScreenHeight = 600
-	boardSize    = 8 // 8 by 8 is 64 as the othello board
+	boardSize    = 8               // 8 by 8 is 64 as the othello board
+	guiMoveTime  = 5 * time.Second // The engine stops before the iterations if it takes longer
 )
 
 type GamePhase int
@@ -26,7 +28,9 @@ const (
 )
 
 type Game struct {
-	node           *PUCTNode
+	engine         Engine    // Plays against the user, NewEngine(DEFAULT_ENGINE) if nil
+	ponderer       *Ponderer // Searches with the engine while the user thinks
+	position       State     // The engine may be pondering, so Update and Draw read the position from here
 	boardImage     *ebiten.Image
 	rng            *rand.Rand
 	legalMoves     uint64 // We put it here because we calculate it at the end of the machine turn
@@ -35,23 +39,50 @@ type Game struct {
 	state          GamePhase
 }
 
+// newGame starts a new game of the engine.
+func (g *Game) newGame() {
+	if g.engine == nil {
+		g.engine = NewEngine(DEFAULT_ENGINE, g.rng)
+		g.ponderer = NewPonderer(g.engine)
+	}
+	g.ponderer.Stop()
+	g.engine.NewGame()
+	g.position = g.engine.State()
+}
+
+// playEngineMove searches and plays the move of the engine.
+func (g *Game) playEngineMove() {
+	move, _ := g.engine.BestMove(context.Background(), Limits{Iterations: 15000, Deadline: time.Now().Add(guiMoveTime)})
+	if err := g.engine.Play(move); err != nil {
+		panic(err) // The engine chose a move that is not legal
+	}
+	g.position = g.engine.State()
+}
+
+// playUserMove stops the pondering and plays the move of the user, the tree of the pondering is kept.
+func (g *Game) playUserMove(move uint8) {
+	g.ponderer.Stop()
+	if err := g.engine.Play(move); err != nil {
+		panic(err) // The move was in legalMoves
+	}
+	g.position = g.engine.State()
+}
+
 func (g *Game) UpdateStartScreen() {
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
 		x, y := ebiten.CursorPosition()
 		if x > 50 && x < 200 && y > 200 && y < 250 { // Black button
-			initialNode := InitialRootPUCTNode()
-			g.node = initialNode
+			g.newGame()
 			g.userIsBlack = true
 			g.state = StatePlaying
 			g.waitingForUser = true // Black moves first
 			// Calculate black's legal moves at start
 			g.legalMoves = generateMoves(
-				g.node.GameState.Boards.Black,
-				g.node.GameState.Boards.White,
+				g.position.Boards.Black,
+				g.position.Boards.White,
 			)
 		} else if x > 50 && x < 200 && y > 300 && y < 350 { // White button
-			initialNode := InitialRootPUCTNode()
-			g.node = initialNode
+			g.newGame()
 			g.userIsBlack = false
 			g.state = StatePlaying
 			g.waitingForUser = false
@@ -63,19 +94,17 @@ func (g *Game) UpdateEndScreen() {
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
 		x, y := ebiten.CursorPosition()
 		if x > 50 && x < 200 && y > 200 && y < 250 { // Restart as Black
-			initialNode := InitialRootPUCTNode()
-			g.node = initialNode
+			g.newGame()
 			g.userIsBlack = true
 			g.state = StatePlaying
 			g.waitingForUser = true // Black moves first
 			// Calculate black's legal moves at start
 			g.legalMoves = generateMoves(
-				g.node.GameState.Boards.Black,
-				g.node.GameState.Boards.White,
+				g.position.Boards.Black,
+				g.position.Boards.White,
 			)
 		} else if x > 50 && x < 200 && y > 300 && y < 350 { // Restart as White
-			initialNode := InitialRootPUCTNode()
-			g.node = initialNode
+			g.newGame()
 			g.userIsBlack = false
 			g.state = StatePlaying
 			g.waitingForUser = false
@@ -90,36 +119,36 @@ func (g *Game) Update() error {
 	case StatePlaying:
 		// original Update logic here
 		if g.waitingForUser {
-			// human turn
+			// human turn, the engine keeps searching in the background meanwhile
+			g.ponderer.Start()
 			if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
 				x, y := ebiten.CursorPosition()
-				col := uint8(x / (tileSize + tileMargin))
-				row := uint8(y / (tileSize + tileMargin))
-				maskIndex := row*8 + col
-				mask := uint64(1) << (uint64(maskIndex))
+				col := x / (tileSize + tileMargin)
+				row := y / (tileSize + tileMargin)
 
-				if g.legalMoves&mask != 0 {
-					g.node = NextPUCTNodeFromInput(g.node, maskIndex)
+				// Clicks outside the board or on illegal squares are ignored
+				if x >= 0 && y >= 0 && checkCoordinates(row, col) == nil && g.legalMoves&(uint64(1)<<(row*8+col)) != 0 {
+					g.playUserMove(uint8(row*8 + col))
 					g.waitingForUser = false
 				}
 			}
 		} else {
 			if !g.userIsBlack {
-				if g.node.GameState.BlackTurn {
-					g.node = SingleRunParallelizationMCTSPUCT(g.node, 15000, g.rng)
+				if g.position.BlackTurn {
+					g.playEngineMove()
 				}
 				// Calculate the possible moves of the opponent if you pass the turn to them
-				if !g.node.GameState.BlackTurn {
-					g.legalMoves = generateMoves(g.node.GameState.Boards.White, g.node.GameState.Boards.Black)
+				if !g.position.BlackTurn {
+					g.legalMoves = generateMoves(g.position.Boards.White, g.position.Boards.Black)
 					g.waitingForUser = true
 				}
 			} else {
-				if !g.node.GameState.BlackTurn {
-					g.node = SingleRunParallelizationMCTSPUCT(g.node, 15000, g.rng)
+				if !g.position.BlackTurn {
+					g.playEngineMove()
 				}
 				// Calculate the possible moves of the opponent if you pass the turn to them
-				if g.node.GameState.BlackTurn {
-					g.legalMoves = generateMoves(g.node.GameState.Boards.Black, g.node.GameState.Boards.White)
+				if g.position.BlackTurn {
+					g.legalMoves = generateMoves(g.position.Boards.Black, g.position.Boards.White)
 					g.waitingForUser = true
 				}
 			}
@@ -127,7 +156,7 @@ func (g *Game) Update() error {
 		}
 
 		// Check if game is over
-		if g.node.IsTerminalPUCT() {
+		if IsTerminalState(g.position) {
 			g.state = StateEndScreen
 		}
 
@@ -149,7 +178,7 @@ func (g *Game) Draw(screen *ebiten.Image) {
 			size := boardSize*tileSize + (boardSize+1)*tileMargin
 			g.boardImage = ebiten.NewImage(size, size)
 		}
-		g.node.GameState.Draw(g.boardImage)
+		g.position.Draw(g.boardImage)
 		if g.waitingForUser {
 			for i := 0; i < 64; i++ {
 				mask := uint64(1) << i
@@ -169,7 +198,7 @@ func (g *Game) Draw(screen *ebiten.Image) {
 
 	case StateEndScreen:
 		screen.Fill(color.RGBA{20, 20, 20, 255})
-		score := CurrentStateScore(g.node.GameState)
+		score := CurrentStateScore(g.position)
 		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Game Over!\nBlack: %d\nWhite: %d", score[0], score[1]), 50, 100)
 		ebitenutil.DebugPrintAt(screen, "Restart as Black", 50, 200)
 		ebitenutil.DebugPrintAt(screen, "Restart as White", 50, 300)
@@ -200,175 +229,35 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
 // 	}
 // }
 
-func Versus() {
-	start := time.Now()
-	rng := rand.New(rand.NewSource(start.UnixNano()))
+// Versus plays a game of OriginalMonteCarloTreeSearch against SingleRunParallelizationMCTS and returns its record.
+func Versus() *GameRecord {
+	seed := NewSeed()
+	rng := rand.New(rand.NewSource(seed))
 	// Each AI needs its own tree, so that they do not share knowledge and influence the other
-	// But they will update each other of their respective moves
-	initialNodeP1 := InitialRootNode()
-	initialNodeP2 := InitialRootNode()
+	// But they will update each other of their respective moves (the engines keep their own tree)
+	baseline := NewEngine("uct", rng)
+	opponent := NewEngine("uct-root-parallel", rng)
 	OpponentIsBlack := false // Is the opponent of baseline black?
-	var nodeP1 *Node
-	var nodeP2 *Node
-	if !OpponentIsBlack {
-		nodeP1 = OriginalMonteCarloTreeSearch(initialNodeP1, 500, rng)
-		nodeP2 = NextNodeFromInput(initialNodeP2, nodeP1.Move)
-		//nodeP2.GameState.Boards.PrintBoard()
-	} else {
-		//nodeP2 = InnacurateMonteCarloTreeSearch(initialNodeP2, 500, OPTIMIZE_FOR_BLACK)
-		nodeP2 = SingleRunParallelizationMCTS(initialNodeP2, 50, rng)
-		nodeP1 = NextNodeFromInput(initialNodeP1, nodeP2.Move)
-		// nodeP1.GameState.Boards.PrintBoard()
-	}
-	for !nodeP1.IsTerminal() { // This works because both nodes update each other
-		if !OpponentIsBlack {
-			if !nodeP1.GameState.BlackTurn {
-				//nodeP2 = InnacurateMonteCarloTreeSearch(nodeP2, 500, OPTIMIZE_FOR_WHITE)
-				nodeP2 = SingleRunParallelizationMCTS(nodeP2, 50, rng)
-				nodeP1 = NextNodeFromInput(nodeP1, nodeP2.Move)
-				//nodeP1.GameState.Boards.PrintBoard()
-			} else {
-				nodeP1 = OriginalMonteCarloTreeSearch(nodeP1, 500, rng)
-				nodeP2 = NextNodeFromInput(nodeP2, nodeP1.Move)
-				//nodeP2.GameState.Boards.PrintBoard()
-			}
-		} else {
-			if nodeP1.GameState.BlackTurn {
-				//nodeP2 = InnacurateMonteCarloTreeSearch(nodeP2, 500, OPTIMIZE_FOR_BLACK)
-				nodeP2 = SingleRunParallelizationMCTS(nodeP2, 50, rng)
-				nodeP1 = NextNodeFromInput(nodeP1, nodeP2.Move)
-				//nodeP1.GameState.Boards.PrintBoard()
-			} else {
-				nodeP1 = OriginalMonteCarloTreeSearch(nodeP1, 500, rng)
-				nodeP2 = NextNodeFromInput(nodeP2, nodeP1.Move)
-				//nodeP2.GameState.Boards.PrintBoard()
-			}
-		}
+	baselineInfo := PlayerInfo{Name: baseline.Name(), Config: "500 iterations", Seed: seed}
+	opponentInfo := PlayerInfo{Name: opponent.Name(), Config: "50 iterations per routine", Seed: seed}
+	baselineLimits := Limits{Iterations: 500}
+	opponentLimits := Limits{Iterations: 50}
+	if OpponentIsBlack {
+		return PlayEngines(opponent, baseline, [2]Limits{opponentLimits, baselineLimits}, [2]PlayerInfo{opponentInfo, baselineInfo})
 	}
+	return PlayEngines(baseline, opponent, [2]Limits{baselineLimits, opponentLimits}, [2]PlayerInfo{baselineInfo, opponentInfo})
 }
 
 // Versus main
 func main() {
-	fmt.Println("GOMAXPROCS:", runtime.GOMAXPROCS(0))
-	start := time.Now()
-	seed := start.UnixNano()
-	rng1 := rand.New(rand.NewSource(seed))
-	rng2 := rand.New(rand.NewSource(seed + 1))
-	// Just one is needed because access is sequential between the 2 AIs  (they dont move at the same time)
-	// And the parallelization already has the necessary protections for sharing rng (each goroutine has its own rng)
-	OpponentWinCounter := 0
-	DrawsCounter := 0
-	Games := 100
-	for i := 0; i < Games; i++ {
-		// Each AI needs its own tree, so that they do not share knowledge and influence the other
-		// But they will update each other of their respective moves
-		initialNodeP1 := InitialRootNode()
-		initialNodeP2 := InitialRootPUCTNode()
-		OpponentIsBlack := false // Is the opponent of baseline black?
-		var nodeP1 *Node
-		var nodeP2 *PUCTNode
-		if !OpponentIsBlack {
-			nodeP1 = OriginalMonteCarloTreeSearch(initialNodeP1, 500, rng1)
-			nodeP2 = NextPUCTNodeFromInput(initialNodeP2, nodeP1.Move)
-			//nodeP2.GameState.Boards.PrintBoard()
-		} else {
-			nodeP2 = SingleRunParallelizationMCTSPUCT(initialNodeP2, 200, rng2)
-			nodeP1 = NextNodeFromInput(initialNodeP1, nodeP2.Move)
-			// nodeP1.GameState.Boards.PrintBoard()
-		}
-		for !nodeP1.IsTerminal() { // This works because both nodes update each other
-			if !OpponentIsBlack {
-				if !nodeP1.GameState.BlackTurn {
-					nodeP2 = SingleRunParallelizationMCTSPUCT(nodeP2, 200, rng2)
-					nodeP1 = NextNodeFromInput(nodeP1, nodeP2.Move)
-					//nodeP1.GameState.Boards.PrintBoard()
-				} else {
-					nodeP1 = OriginalMonteCarloTreeSearch(nodeP1, 500, rng1)
-					nodeP2 = NextPUCTNodeFromInput(nodeP2, nodeP1.Move)
-					//nodeP2.GameState.Boards.PrintBoard()
-				}
-			} else {
-				if nodeP1.GameState.BlackTurn {
-					nodeP2 = SingleRunParallelizationMCTSPUCT(nodeP2, 200, rng2)
-					nodeP1 = NextNodeFromInput(nodeP1, nodeP2.Move)
-					//nodeP1.GameState.Boards.PrintBoard()
-				} else {
-					nodeP1 = OriginalMonteCarloTreeSearch(nodeP1, 500, rng1)
-					nodeP2 = NextPUCTNodeFromInput(nodeP2, nodeP1.Move)
-					//nodeP2.GameState.Boards.PrintBoard()
-				}
-			}
-		}
-		if nodeP1.IsTerminal() {
-			//OutputResult(nodeP1)
-			//OutputResult(nodeP2)
-			switch nodeP1.Winner() {
-			case BLACK_WIN:
-				if OpponentIsBlack {
-					OpponentWinCounter++
-				}
-			case WHITE_WIN:
-				if !OpponentIsBlack {
-					OpponentWinCounter++
-				}
-			case DRAW:
-				DrawsCounter++
-			}
-		}
-		fmt.Printf("Number of finalized games: %d\n", i+1)
+	// Other modes of the program are run as commands, for example: othello perft 10
+	if len(os.Args) > 1 && runCommand(os.Args[1:]) {
+		return
 	}
-	elapsed := time.Since(start)
-	fmt.Printf("Opponent Wins: %d\n", OpponentWinCounter)
-	fmt.Printf("Draws: %d\n", DrawsCounter)
-	fmt.Printf("Total Games ran: %d\n", Games)
-	fmt.Printf("Total run time for all the games: %s", elapsed)
-
+	runVersus(nil)
 }
 
-// Debugging Main
-// func main() {
-// 	start := time.Now()
-// 	rng := rand.New(rand.NewSource(start.UnixNano()))
-// 	initialNode := InitialRootNode()
-// 	initialNode.GameState.Boards.PrintBoard()
-// 	userIsBlack := RequestUserIsBlack()
-// 	var node *Node
-// 	if !userIsBlack {
-// 		bestOpening := SingleRunParallelizationMCTS(initialNode, 5000, rng)
-// 		bestOpening.GameState.Boards.PrintBoard()
-// 		node = bestOpening
-// 	} else {
-// 		initialNode.GameState.PrintBoardWithMoves()
-// 		blackMove := RequestMove(userIsBlack)
-// 		node = NextNodeFromInput(initialNode, blackMove)
-// 	}
-// 	for !node.IsTerminal() {
-// 		if !userIsBlack {
-// 			if !node.GameState.BlackTurn {
-// 				node.GameState.PrintBoardWithMoves()
-// 				whiteMove := RequestMove(userIsBlack)
-// 				node = NextNodeFromInput(node, whiteMove)
-// 			} else {
-// 				mctsNode := SingleRunParallelizationMCTS(node, 5000, rng)
-// 				mctsNode.GameState.Boards.PrintBoard()
-// 				node = mctsNode
-// 			}
-// 		} else {
-// 			if node.GameState.BlackTurn {
-// 				node.GameState.PrintBoardWithMoves()
-// 				blackMove := RequestMove(userIsBlack)
-// 				node = NextNodeFromInput(node, blackMove)
-// 			} else {
-// 				mctsNode := SingleRunParallelizationMCTS(node, 5000, rng)
-// 				mctsNode.GameState.Boards.PrintBoard()
-// 				node = mctsNode
-// 			}
-// 		}
-// 	}
-// 	if node.IsTerminal() {
-// 		OutputResult(node)
-// 	}
-// }
+// Debugging Main: the terminal game is now the play command (see runPlay in commands.go)
 
 // func main() {
 // 	// Just a quick test to verify the output is the same
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"math"
 	"math/rand"
-	"time"
 )
 
 // OptimizeFor declares for who you need to optimize the moves for.
@@ -23,23 +23,47 @@ func (node *Node) Expand() *Node {
 	// Pop
 	move := node.UntriedMoves[len(node.UntriedMoves)-1]
 	node.UntriedMoves = node.UntriedMoves[:len(node.UntriedMoves)-1]
+	return node.expandMove(move)
+}
 
-	// We generate a new node because make move does not generate a new board by default
-	newBoards := node.GameState.Boards // Copy
-	newBoards.MakeMoveIndex(node.GameState.BlackTurn, move)
-
-	nextState := State{
-		Boards:    newBoards,
-		BlackTurn: !node.GameState.BlackTurn, // SWITCH TURN
+// ChildForMove returns the child of the current node reached by the given move.
+// If the child has not been expanded yet it is created and added to the tree.
+func (node *Node) ChildForMove(move uint8) *Node {
+	for _, child := range node.Children {
+		if child.Move == move {
+			return child
+		}
 	}
-
-	// Edge case: (If in the next turn the player cannot make a move switch the turn again)
-
-	if !nextState.Boards.HasValidMove(nextState.BlackTurn) && nextState.Boards.HasValidMove(!nextState.BlackTurn) {
-		nextState.BlackTurn = !nextState.BlackTurn
+	for i, untried := range node.UntriedMoves {
+		if untried == move {
+			node.UntriedMoves = append(node.UntriedMoves[:i], node.UntriedMoves[i+1:]...)
+			break
+		}
 	}
+	return node.expandMove(move)
+}
+
+// expandMove makes the move on a copy of the state and adds the resulting child to the node.
+// If the tree has a transposition table the child starts with the statistics already known for its position
+// (scaled down to the visits of the node that the other children do not have, see seedVisits).
+func (node *Node) expandMove(move uint8) *Node {
+	// We generate a new node because make move does not generate a new board by default
+	nextState := node.GameState // Copy
+	nextState.ApplyMove(move)
 	// Generate the child with the new values and add it to the list of children of the node
 	child := NewNode(nextState, node, move)
+	if node.Table != nil {
+		if stats, found := node.Table.Lookup(nextState.Hash); found {
+			childrenVisits := 0
+			for _, other := range node.Children {
+				childrenVisits += other.Visits
+			}
+			if visits := seedVisits(stats, node.Visits, childrenVisits); visits > 0 {
+				child.Visits = visits
+				child.Wins = stats.WinsFor(node.GameState.BlackTurn) * visits / stats.Visits
+			}
+		}
+	}
 	node.Children = append(node.Children, child)
 	return child
 }
@@ -57,16 +81,18 @@ func AgressiveTraverse(node *Node) *Node {
 }
 
 // Select traverses until reaching a leaf using OriginalBestUCT.
+// It stops at proven nodes (terminal nodes are proven), their result is known without expanding them.
 func Select(node *Node, c float64) *Node {
-	for node.IsFullyExpanded() && !node.IsTerminal() {
+	for node.IsFullyExpanded() && !node.Proven {
 		node = OriginalBestUCT(node, c)
 	}
 	return node
 }
 
 // ExpandLeaf expands the node if there are moves left to try, by creating new children.
+// A proven node is not expanded.
 func ExpandLeaf(node *Node) *Node {
-	if node.IsTerminal() {
+	if node.Proven || node.IsTerminal() {
 		return node
 	}
 	return node.Expand()
@@ -106,6 +132,7 @@ func AgressiveBestUCT(node *Node, c float64) *Node {
 }
 
 // OriginalBestUCT chooses the best child to explore using UCT.
+// A proven loss is only chosen if every child is one (UCT values are never negative).
 func OriginalBestUCT(node *Node, c float64) *Node {
 	var best *Node
 	bestUCT := float64(-1 << 63)
@@ -114,6 +141,9 @@ func OriginalBestUCT(node *Node, c float64) *Node {
 		explorationTerm := math.Sqrt(math.Log(float64(node.Visits)) / float64(child.Visits))
 		C := math.Sqrt(c)                               // Theoretical value, will try to find a better one through self play
 		UCTValue := C*explorationTerm + explotationTerm // This is the correct formula
+		if isProvenLoss(child, node.GameState.BlackTurn) {
+			UCTValue = -1
+		}
 
 		if UCTValue > bestUCT {
 			bestUCT = UCTValue
@@ -189,9 +219,13 @@ func InnacurateBackpropagate(node *Node, result WinState, optimizeFor OptimizeFo
 
 // OriginalBackpropagate backpropagates the results to each node until the root of the given tree is reached.
 // Update visits and wins (A tie also counts as a win).
+// The statistics in the transposition table (if any) are updated too, so transpositions can reuse them.
 func OriginalBackpropagate(node *Node, result WinState) {
 	for n := node; n != nil; n = n.Parent {
 		n.Visits++
+		if n.Table != nil {
+			recordResult(n.Table, n.GameState.Hash, result)
+		}
 		if p := n.Parent; p != nil {
 			isBlackTurn := p.GameState.BlackTurn
 			isBlackWin := (result == BLACK_WIN || result == DRAW)
@@ -205,13 +239,17 @@ func OriginalBackpropagate(node *Node, result WinState) {
 
 // BestNodeFromMCTS returns the child node, of the current node, with the most visits.
 // Used once MCTS has Backpropagated the results updating the statistics.
+// A proven win is the best whatever its visits, and a proven loss is only returned if every child is one.
 func BestNodeFromMCTS(node *Node) *Node {
 	var bestNode *Node
-	maxVisits := -1
+	bestLosing := false
 	for _, child := range node.Children {
-		if child.Visits > maxVisits {
-			maxVisits = child.Visits
-			bestNode = child
+		if result, proven := child.proof(); proven && result == winFor(node.GameState.BlackTurn) {
+			return child
+		}
+		losing := isProvenLoss(child, node.GameState.BlackTurn)
+		if bestNode == nil || (bestLosing && !losing) || (bestLosing == losing && child.Visits > bestNode.Visits) {
+			bestNode, bestLosing = child, losing
 		}
 	}
 	return bestNode
@@ -221,63 +259,107 @@ func BestNodeFromMCTS(node *Node) *Node {
 // Montecarlo Tree search algorithm with agressive UCT (traverse), double expansion and incorrect backpropagation.
 // This model is more fun to play against than normal MCTS.
 func InnacurateMonteCarloTreeSearch(currentRoot *Node, iterations int, optimizeFor OptimizeFor, rng *rand.Rand) *Node {
+	best, _ := InnacurateMonteCarloTreeSearchContext(context.Background(), currentRoot, Limits{Iterations: iterations}, optimizeFor, rng)
+	return best
+}
+
+// InnacurateMonteCarloTreeSearchContext is InnacurateMonteCarloTreeSearch until the limits are reached or ctx is cancelled.
+// Returns the best move and the number of playouts that ran.
+func InnacurateMonteCarloTreeSearchContext(ctx context.Context, currentRoot *Node, limits Limits, optimizeFor OptimizeFor, rng *rand.Rand) (*Node, int) {
 	if currentRoot.IsTerminal() {
-		return currentRoot
+		return currentRoot, 0
 	}
+	limiter := newSearchLimiter(ctx, limits)
 	if optimizeFor == OPTIMIZE_FOR_BLACK {
-		for i := 0; i < iterations; i++ {
+		for limiter.next() {
 			leaf := AgressiveTraverse(currentRoot) // Select and Expand are coded in Traverse
+			nodes := 1                             // Traverse expands unless it reaches the end of the game
+			if leaf.IsTerminal() {
+				nodes = 0
+			}
 			var nodeToSimulateFrom *Node
 			if len(leaf.UntriedMoves) > 0 {
 				child := leaf.Expand() // This is a double expansion which is not in the normal implementation
 				nodeToSimulateFrom = child
+				nodes++
 			} else {
 				nodeToSimulateFrom = leaf
 			}
 
 			result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
 			InnacurateBackpropagate(nodeToSimulateFrom, result, optimizeFor)
+			limiter.played(nodes)
 		}
 	} else {
-		for i := 0; i < iterations; i++ {
+		for limiter.next() {
 			// It does not benefit from being agressive on white, so we use Original Traverseß
 			selected := Select(currentRoot, 2.0)
 			nodeToSimulateFrom := ExpandLeaf(selected)
 			result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
 			InnacurateBackpropagate(nodeToSimulateFrom, result, optimizeFor)
+			limiter.played(newNodes(selected, nodeToSimulateFrom))
 		}
 	}
 
-	return BestNodeFromMCTS(currentRoot)
+	return BestNodeFromMCTS(currentRoot), limiter.playouts
+}
+
+// searchOriginalMCTS runs MCTS with UCT from the root until the limits are reached and returns the number of playouts.
+func searchOriginalMCTS(ctx context.Context, currentRoot *Node, limits Limits, rng *rand.Rand) int {
+	limiter := newSearchLimiter(ctx, limits)
+	for limiter.next() {
+		selected := Select(currentRoot, 2.0)
+		nodeToSimulateFrom := ExpandLeaf(selected)
+		if nodeToSimulateFrom.Proven {
+			OriginalBackpropagate(nodeToSimulateFrom, nodeToSimulateFrom.ProvenResult) // The exact result, no rollout
+			proveAncestors(nodeToSimulateFrom)
+		} else {
+			OriginalBackpropagate(nodeToSimulateFrom, SimulateRollout(nodeToSimulateFrom.GameState, rng))
+		}
+		limiter.played(newNodes(selected, nodeToSimulateFrom))
+		if currentRoot.Proven {
+			break // The result of the game is known, the best move does not change anymore
+		}
+	}
+	return limiter.playouts
 }
 
 // OriginalMonteCarloTreeSearch implemented as usual.
 // Returns the best move determined by MCTS with UCT.
+// Close to the end of the game the exact solver is used instead (see EndgameEmpties).
 func OriginalMonteCarloTreeSearch(currentRoot *Node, iterations int, rng *rand.Rand) *Node {
+	best, _ := OriginalMonteCarloTreeSearchContext(context.Background(), currentRoot, Limits{Iterations: iterations}, rng)
+	return best
+}
+
+// OriginalMonteCarloTreeSearchContext is OriginalMonteCarloTreeSearch until the limits are reached or ctx is cancelled.
+// Returns the best move and the number of playouts that ran (0 if the solver was used).
+func OriginalMonteCarloTreeSearchContext(ctx context.Context, currentRoot *Node, limits Limits, rng *rand.Rand) (*Node, int) {
 	if currentRoot.IsTerminal() {
-		return currentRoot
+		return currentRoot, 0
 	}
-	for i := 0; i < iterations; i++ {
-		selected := Select(currentRoot, 2.0)
-		nodeToSimulateFrom := ExpandLeaf(selected)
-		result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
-		OriginalBackpropagate(nodeToSimulateFrom, result)
+	if limits.solves(currentRoot.GameState) {
+		if best := solvedBestNodeWithin(ctx, currentRoot, limits); best != nil {
+			return best, 0
+		}
 	}
-	return BestNodeFromMCTS(currentRoot)
+	playouts := searchOriginalMCTS(ctx, currentRoot, limits, rng)
+	return BestNodeFromMCTS(currentRoot), playouts
 }
 
 // RootAfterOriginalMCTS returns the root, with the updated info, instead of the best move.
 func RootAfterOriginalMCTS(currentRoot *Node, iterations int, rng *rand.Rand) *Node {
+	root, _ := RootAfterOriginalMCTSContext(context.Background(), currentRoot, Limits{Iterations: iterations}, rng)
+	return root
+}
+
+// RootAfterOriginalMCTSContext is RootAfterOriginalMCTS until the limits are reached or ctx is cancelled.
+// Returns the root and the number of playouts that ran.
+func RootAfterOriginalMCTSContext(ctx context.Context, currentRoot *Node, limits Limits, rng *rand.Rand) (*Node, int) {
 	if currentRoot.IsTerminal() {
-		return currentRoot
+		return currentRoot, 0
 	}
-	for i := 0; i < iterations; i++ {
-		selected := Select(currentRoot, 2.0)
-		nodeToSimulateFrom := ExpandLeaf(selected)
-		result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
-		OriginalBackpropagate(nodeToSimulateFrom, result)
-	}
-	return currentRoot
+	return currentRoot, searchOriginalMCTS(ctx, currentRoot, limits, rng)
 }
 
 // OriginalMCTSWinsPlayoutsByMove returns back the number of games and wins per move from the given node.
@@ -287,57 +369,152 @@ func OriginalMCTSWinsPlayoutsByMove(currentRoot *Node, iterations int, rng *rand
 	if currentRoot.IsTerminal() {
 		return nil
 	}
-	for i := 0; i < iterations; i++ {
-		selected := Select(currentRoot, 2.0)
-		nodeToSimulateFrom := ExpandLeaf(selected)
-		result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
-		OriginalBackpropagate(nodeToSimulateFrom, result)
-	}
-	movesWithRatio := make(map[uint8]int, len(currentRoot.Children))
-	for _, child := range currentRoot.Children {
+	searchOriginalMCTS(context.Background(), currentRoot, Limits{Iterations: iterations}, rng)
+	return visitsByMove(currentRoot) // We return a map with the information needed
+}
+
+// visitsByMove returns the visits of the children of the node by move.
+func visitsByMove(node *Node) map[uint8]int {
+	movesWithRatio := make(map[uint8]int, len(node.Children))
+	for _, child := range node.Children {
 		movesWithRatio[child.Move] = child.Visits
 	}
-	return movesWithRatio // We return a map with the information needed
+	return movesWithRatio
+}
+
+// parallelResult is the result of a worker of a root parallel search.
+type parallelResult struct {
+	visits   map[uint8]int     // Visits of the root children by move
+	wins     map[uint8]float64 // Wins of the root children by move (the sum of the rewards for PUCT)
+	playouts int
 }
 
 // SingleRunParallelizationMCTS is a root level parallelization of MCTS.
 // It works by generating one master tree and at the same time running in parallel simulations that will be used
 // to update the first level of the master tree (the children ) with statistics from the parallel simulations.
 // This method decreases the variance according to research.
+// The workers are the ones of a package level SearchPool shared by every call (its rngs are split from
+// NewSeed, not from baseRNG), an engine keeps a pool of its own instead.
 func SingleRunParallelizationMCTS(currentRoot *Node, iterationsPerRoutine int, baseRNG *rand.Rand) *Node {
-	maxProcesses := 9
-	firstLayerRes := make(chan map[uint8]int, maxProcesses)
-	masterTree := make(chan *Node, 1)
-	go func() {
-		masterTree <- RootAfterOriginalMCTS(currentRoot, iterationsPerRoutine, baseRNG)
-	}()
-	for i := 0; i < maxProcesses; i++ {
-		go func(id int) {
-			parallelRNGi := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
-			var emptyMove uint8
-			broadcastedNode := NewNode(currentRoot.GameState, nil, emptyMove)
-			// We just need the state of the root (the tree can be generated of it), we don't care about the parent of this one
-			// We need to do this because if we share the original root there will be race conditions
-			parallelResult := OriginalMCTSWinsPlayoutsByMove(broadcastedNode, iterationsPerRoutine, parallelRNGi)
-			firstLayerRes <- parallelResult
-		}(i)
-	}
-	// Wait for all of them to complete
-	currentRoot = <-masterTree // update the tree with the result of 1 simulation (this will be the base)
-	close(masterTree)
-	// Collect exactly maxProcesses results from worker goroutines
-	for i := 0; i < maxProcesses; i++ {
-		dict := <-firstLayerRes
-		// Accumulate worker results into master's children
-		for _, child := range currentRoot.Children {
-			if res, exists := dict[child.Move]; exists {
-				child.Visits += res
+	best, _ := SingleRunParallelizationMCTSContext(context.Background(), currentRoot, Limits{Iterations: iterationsPerRoutine}, baseRNG)
+	return best
+}
+
+// SingleRunParallelizationMCTSContext is SingleRunParallelizationMCTS until the limits (the iterations of
+// every routine) are reached or ctx is cancelled. Returns the best move and the number of playouts of all the routines.
+func SingleRunParallelizationMCTSContext(ctx context.Context, currentRoot *Node, limits Limits, baseRNG *rand.Rand) (*Node, int) {
+	return defaultSearchPool().SingleRunParallelizationMCTSContext(ctx, currentRoot, limits, baseRNG)
+}
+
+// leafRolloutPool runs the rollouts of a leaf parallel search, every worker has its own rng.
+// Every worker has its own jobs too, so each rng simulates the same rollouts in every run (see DeterministicSearch).
+type leafRolloutPool struct {
+	jobs    []chan State
+	results chan WinState
+}
+
+// newLeafRolloutPool starts the workers of a pool, they run until close is called.
+func newLeafRolloutPool(workers int, baseRNG *rand.Rand) *leafRolloutPool {
+	pool := &leafRolloutPool{jobs: make([]chan State, workers), results: make(chan WinState, workers)}
+	seed := baseRNG.Int63()
+	for i := range pool.jobs {
+		jobs := make(chan State, 1)
+		pool.jobs[i] = jobs
+		workerRNG := NewStreamRNG(seed, i)
+		go func() {
+			for state := range jobs {
+				pool.results <- SimulateRollout(state, workerRNG)
+			}
+		}()
+	}
+	return pool
+}
+
+// rollouts simulates one game from the state per worker concurrently and returns their results.
+func (pool *leafRolloutPool) rollouts(state State, results []WinState) []WinState {
+	for _, jobs := range pool.jobs {
+		jobs <- state
+	}
+	results = results[:0]
+	for range pool.jobs {
+		results = append(results, <-pool.results)
+	}
+	return results
+}
+
+// close stops the workers of the pool.
+func (pool *leafRolloutPool) close() {
+	for _, jobs := range pool.jobs {
+		close(jobs)
+	}
+}
+
+// backpropagateLeafResults is OriginalBackpropagate of several results at once.
+func backpropagateLeafResults(node *Node, results []WinState) {
+	var counts [3]int // Indexed by WinState
+	for _, result := range results {
+		counts[result]++
+	}
+	for n := node; n != nil; n = n.Parent {
+		n.Visits += len(results)
+		if n.Table != nil {
+			for _, result := range results {
+				recordResult(n.Table, n.GameState.Hash, result)
+			}
+		}
+		if p := n.Parent; p != nil {
+			if p.GameState.BlackTurn {
+				n.Wins += counts[BLACK_WIN] + counts[DRAW]
+			} else {
+				n.Wins += counts[WHITE_WIN] + counts[DRAW]
 			}
 		}
 	}
-	return BestNodeFromMCTS(currentRoot)
 }
 
-// func leafParallelizationMCTS(currentRoot *Node, iterationsPerRoutine int) *Node {
-// Run multiple go routines once you get to a leaf
-// }
+// LeafParallelizationMCTS is a leaf level parallelization of MCTS.
+// There is a single tree, but every leaf reached is simulated by one rollout per worker (see SearchWorkers) at the same time,
+// and the results are backpropagated together. The tree grows slower than with root parallelization,
+// but the statistics of every leaf are more reliable.
+func LeafParallelizationMCTS(currentRoot *Node, iterationsPerRoutine int, baseRNG *rand.Rand) *Node {
+	best, _ := LeafParallelizationMCTSContext(context.Background(), currentRoot, Limits{Iterations: iterationsPerRoutine}, baseRNG)
+	return best
+}
+
+// LeafParallelizationMCTSContext is LeafParallelizationMCTS until the limits (the iterations of
+// every routine) are reached or ctx is cancelled. Returns the best move and the number of playouts of all the routines.
+func LeafParallelizationMCTSContext(ctx context.Context, currentRoot *Node, limits Limits, baseRNG *rand.Rand) (*Node, int) {
+	if currentRoot.IsTerminal() {
+		return currentRoot, 0
+	}
+	if limits.solves(currentRoot.GameState) {
+		if best := solvedBestNodeWithin(ctx, currentRoot, limits); best != nil {
+			return best, 0
+		}
+	}
+	workers := searchWorkers()
+	pool := newLeafRolloutPool(workers, baseRNG)
+	defer pool.close()
+	results := make([]WinState, 0, workers)
+	limiter := newSearchLimiter(ctx, limits) // Every leaf is one playout of each routine
+	for limiter.next() {
+		selected := Select(currentRoot, 2.0)
+		nodeToSimulateFrom := ExpandLeaf(selected)
+		if nodeToSimulateFrom.Proven {
+			results = results[:0]
+			for i := 0; i < workers; i++ {
+				results = append(results, nodeToSimulateFrom.ProvenResult) // The exact result, no rollouts
+			}
+			backpropagateLeafResults(nodeToSimulateFrom, results)
+			proveAncestors(nodeToSimulateFrom)
+		} else {
+			results = pool.rollouts(nodeToSimulateFrom.GameState, results)
+			backpropagateLeafResults(nodeToSimulateFrom, results)
+		}
+		limiter.played(newNodes(selected, nodeToSimulateFrom))
+		if currentRoot.Proven {
+			break // The result of the game is known, the best move does not change anymore
+		}
+	}
+	return BestNodeFromMCTS(currentRoot), limiter.playouts * workers
+}
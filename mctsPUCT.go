@@ -1,22 +1,24 @@
 package main
 
 import (
+	"context"
 	"math"
 	"math/rand"
-	"time"
 )
 
 // SelectPUCT traverses tree until a leaf node is found using PUCT.
+// It stops at proven nodes (terminal nodes are proven), their result is known without expanding them.
 func SelectPUCT(node *PUCTNode, c float64) *PUCTNode {
-	for node.IsFullyExpandedPUCT() && !node.IsTerminalPUCT() {
+	for node.IsFullyExpandedPUCT() && !node.Proven {
 		node = BestPUCT(node, c)
 	}
 	return node
 }
 
 // ExpandLeafPUCT expands the  leaf node if there are moves left to try, creating new children.
+// A proven node is not expanded.
 func ExpandLeafPUCT(node *PUCTNode) *PUCTNode {
-	if node.IsTerminalPUCT() {
+	if node.Proven || node.IsTerminalPUCT() {
 		return node
 	}
 	return node.ExpandPUCT()
@@ -30,23 +32,48 @@ func (node *PUCTNode) ExpandPUCT() *PUCTNode {
 	// Pop
 	move := node.UntriedMoves[len(node.UntriedMoves)-1]
 	node.UntriedMoves = node.UntriedMoves[:len(node.UntriedMoves)-1]
+	return node.expandMovePUCT(move)
+}
 
-	// We generate a new node because make move does not generate a new board by default
-	newBoards := node.GameState.Boards // Copy
-	newBoards.MakeMoveIndex(node.GameState.BlackTurn, move)
-
-	nextState := State{
-		Boards:    newBoards,
-		BlackTurn: !node.GameState.BlackTurn, // SWITCH TURN
+// ChildForMovePUCT returns the child of the current node reached by the given move.
+// If the child has not been expanded yet it is created and added to the tree.
+func (node *PUCTNode) ChildForMovePUCT(move uint8) *PUCTNode {
+	for _, child := range node.Children {
+		if child.Move == move {
+			return child
+		}
 	}
-
-	// Edge case: (If in the next turn the player cannot make a move switch the turn again)
-
-	if !nextState.Boards.HasValidMove(nextState.BlackTurn) && nextState.Boards.HasValidMove(!nextState.BlackTurn) {
-		nextState.BlackTurn = !nextState.BlackTurn
+	for i, untried := range node.UntriedMoves {
+		if untried == move {
+			node.UntriedMoves = append(node.UntriedMoves[:i], node.UntriedMoves[i+1:]...)
+			break
+		}
 	}
+	return node.expandMovePUCT(move)
+}
+
+// expandMovePUCT makes the move on a copy of the state and adds the resulting child to the node.
+// If the tree has a transposition table the child starts with the statistics already known for its position
+// (scaled down to the visits of the node that the other children do not have, see seedVisits).
+func (node *PUCTNode) expandMovePUCT(move uint8) *PUCTNode {
+	// We generate a new node because make move does not generate a new board by default
+	nextState := node.GameState // Copy
+	nextState.ApplyMove(move)
 	// Generate the child with the new values and add it to the list of children of the node
 	child := NewPUCTNode(nextState, node, move)
+	if node.Table != nil {
+		if stats, found := node.Table.Lookup(nextState.Hash); found {
+			childrenVisits := 0
+			for _, visits := range node.N {
+				childrenVisits += visits
+			}
+			if visits := seedVisits(stats, node.Visits, childrenVisits); visits > 0 {
+				child.Visits = visits
+				node.N[move] = visits
+				node.Q[move] = stats.RewardFor(node.GameState.BlackTurn)
+			}
+		}
+	}
 	node.Children = append(node.Children, child)
 	return child
 }
@@ -71,9 +98,13 @@ func rewardFor(parentBlackTurn bool, result WinState) float64 {
 }
 
 // BackpropagatePUCT updates visits and wins (A tie counts as 0.5)
+// The statistics in the transposition table (if any) are updated too, so transpositions can reuse them.
 func BackpropagatePUCT(node *PUCTNode, result WinState) {
 	for n := node; n != nil; n = n.Parent {
 		n.Visits++
+		if n.Table != nil {
+			recordResult(n.Table, n.GameState.Hash, result)
+		}
 		p := n.Parent
 		if p == nil {
 			continue // Skip to next iteration where n will be nil
@@ -87,6 +118,7 @@ func BackpropagatePUCT(node *PUCTNode, result WinState) {
 }
 
 // BestPUCT returns the best child node, of the curent node, according to the PUCT equation.
+// A proven loss is only chosen if every child is one (PUCT values are never negative).
 func BestPUCT(node *PUCTNode, c float64) *PUCTNode {
 	var bestChildNode *PUCTNode
 	bestPUCT := -math.MaxFloat64
@@ -98,6 +130,9 @@ func BestPUCT(node *PUCTNode, c float64) *PUCTNode {
 		totalVisitsOfAction := float64(node.N[move])
 
 		childPUCT := estimatedValueOfAction + (c*behaviorPolicy)*math.Sqrt(float64(totalVisitsOfNode))/(1+totalVisitsOfAction)
+		if isProvenLoss(child, node.GameState.BlackTurn) {
+			childPUCT = -1
+		}
 
 		if childPUCT > bestPUCT {
 			bestPUCT = childPUCT
@@ -108,30 +143,62 @@ func BestPUCT(node *PUCTNode, c float64) *PUCTNode {
 }
 
 // BestNodeFromMCTSPUCT selects the best child node, move, (The one with most visits) once MCTS has Backpropagated.
+// A proven win is the best whatever its visits, and a proven loss is only returned if every child is one.
 func BestNodeFromMCTSPUCT(node *PUCTNode) *PUCTNode {
 	var bestNode *PUCTNode
-	maxVisits := -1
+	bestLosing := false
 	for _, child := range node.Children {
-		if child.Visits > maxVisits {
-			maxVisits = child.Visits
-			bestNode = child
+		if result, proven := child.proof(); proven && result == winFor(node.GameState.BlackTurn) {
+			return child
+		}
+		losing := isProvenLoss(child, node.GameState.BlackTurn)
+		if bestNode == nil || (bestLosing && !losing) || (bestLosing == losing && child.Visits > bestNode.Visits) {
+			bestNode, bestLosing = child, losing
 		}
 	}
 	return bestNode
 }
 
+// searchMCTSPUCT runs MCTS with PUCT from the root until the limits are reached and returns the number of playouts.
+func searchMCTSPUCT(ctx context.Context, currentRoot *PUCTNode, limits Limits, rng *rand.Rand) int {
+	limiter := newSearchLimiter(ctx, limits)
+	for limiter.next() {
+		selected := SelectPUCT(currentRoot, 2.0)
+		nodeToSimulateFrom := ExpandLeafPUCT(selected)
+		if nodeToSimulateFrom.Proven {
+			BackpropagatePUCT(nodeToSimulateFrom, nodeToSimulateFrom.ProvenResult) // The exact result, no rollout
+			proveAncestorsPUCT(nodeToSimulateFrom)
+		} else {
+			BackpropagatePUCT(nodeToSimulateFrom, SimulateRollout(nodeToSimulateFrom.GameState, rng))
+		}
+		limiter.played(newNodes(selected, nodeToSimulateFrom))
+		if currentRoot.Proven {
+			break // The result of the game is known, the best move does not change anymore
+		}
+	}
+	return limiter.playouts
+}
+
 // MonteCarloTreeSearchPUCT determines the best move, from the current state/node, using MCTS with PUCT equation.
+// Close to the end of the game the exact solver is used instead (see EndgameEmpties).
 func MonteCarloTreeSearchPUCT(currentRoot *PUCTNode, iterations int, rng *rand.Rand) *PUCTNode {
+	best, _ := MonteCarloTreeSearchPUCTContext(context.Background(), currentRoot, Limits{Iterations: iterations}, rng)
+	return best
+}
+
+// MonteCarloTreeSearchPUCTContext is MonteCarloTreeSearchPUCT until the limits are reached or ctx is cancelled.
+// Returns the best move and the number of playouts that ran (0 if the solver was used).
+func MonteCarloTreeSearchPUCTContext(ctx context.Context, currentRoot *PUCTNode, limits Limits, rng *rand.Rand) (*PUCTNode, int) {
 	if currentRoot.IsTerminalPUCT() {
-		return currentRoot
+		return currentRoot, 0
 	}
-	for i := 0; i < iterations; i++ {
-		selected := SelectPUCT(currentRoot, 2.0)
-		nodeToSimulateFrom := ExpandLeafPUCT(selected)
-		result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
-		BackpropagatePUCT(nodeToSimulateFrom, result)
+	if limits.solves(currentRoot.GameState) {
+		if best := solvedBestNodePUCTWithin(ctx, currentRoot, limits); best != nil {
+			return best, 0
+		}
 	}
-	return BestNodeFromMCTSPUCT(currentRoot)
+	playouts := searchMCTSPUCT(ctx, currentRoot, limits, rng)
+	return BestNodeFromMCTSPUCT(currentRoot), playouts
 }
 
 // OriginalMCTSWinsPlayoutsByMove returns back the number of visits by move after MCTS PUCT
@@ -141,28 +208,24 @@ func MCTSPUCTWinsPlayoutsByMove(currentRoot *PUCTNode, iterations int, rng *rand
 	if currentRoot.IsTerminalPUCT() {
 		return nil
 	}
-	for i := 0; i < iterations; i++ {
-		selected := SelectPUCT(currentRoot, 2.0)
-		nodeToSimulateFrom := ExpandLeafPUCT(selected)
-		result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
-		BackpropagatePUCT(nodeToSimulateFrom, result)
-	}
+	searchMCTSPUCT(context.Background(), currentRoot, Limits{Iterations: iterations}, rng)
 	return currentRoot.N // We return a map with the information needed to make the final decision
 	// We just need to return the visits
 }
 
 // RootAfterMCTSPUCT returns the root, with the updated info, instead of the best move.
 func RootAfterMCTSPUCT(currentRoot *PUCTNode, iterations int, rng *rand.Rand) *PUCTNode {
+	root, _ := RootAfterMCTSPUCTContext(context.Background(), currentRoot, Limits{Iterations: iterations}, rng)
+	return root
+}
+
+// RootAfterMCTSPUCTContext is RootAfterMCTSPUCT until the limits are reached or ctx is cancelled.
+// Returns the root and the number of playouts that ran.
+func RootAfterMCTSPUCTContext(ctx context.Context, currentRoot *PUCTNode, limits Limits, rng *rand.Rand) (*PUCTNode, int) {
 	if currentRoot.IsTerminalPUCT() {
-		return currentRoot
-	}
-	for i := 0; i < iterations; i++ {
-		selected := SelectPUCT(currentRoot, 2.0)
-		nodeToSimulateFrom := ExpandLeafPUCT(selected)
-		result := SimulateRollout(nodeToSimulateFrom.GameState, rng)
-		BackpropagatePUCT(nodeToSimulateFrom, result)
+		return currentRoot, 0
 	}
-	return currentRoot
+	return currentRoot, searchMCTSPUCT(ctx, currentRoot, limits, rng)
 }
 
 // SingleRunParallelizationMCTSPUCT is a root level parallelization of MCTS PUCT.
@@ -170,39 +233,15 @@ func RootAfterMCTSPUCT(currentRoot *PUCTNode, iterations int, rng *rand.Rand) *P
 // that will be used to update the first level of the master tree (the children )
 // with statistics from the parallel simulations.
 // This method decreases the variance according to research.
+// The workers are the ones of a package level SearchPool shared by every call (its rngs are split from
+// NewSeed, not from baseRNG), an engine keeps a pool of its own instead.
 func SingleRunParallelizationMCTSPUCT(currentRoot *PUCTNode, iterationsPerRoutine int, baseRNG *rand.Rand) *PUCTNode {
-	maxProcesses := 9
-	firstLayerRes := make(chan map[uint8]int, maxProcesses)
-	masterTree := make(chan *PUCTNode, 1)
-	go func() {
-		masterTree <- RootAfterMCTSPUCT(currentRoot, iterationsPerRoutine, baseRNG)
-	}()
-	for i := 0; i < maxProcesses; i++ {
-		go func(id int) {
-			// We provide a different rng per parallelization to avoid having the same results.
-			parallelRNGi := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
-			var emptyMove uint8
-			broadcastedNode := NewPUCTNode(currentRoot.GameState, nil, emptyMove)
-			// We just need the state of the root (the tree can be generated of it), we don't care about the parent of this one
-			// We need to do this because if we share the original root there will be race conditions
-			parallelResult := MCTSPUCTWinsPlayoutsByMove(broadcastedNode, iterationsPerRoutine, parallelRNGi)
-			firstLayerRes <- parallelResult
-		}(i)
-	}
-	// Wait for all of them to complete
-	currentRoot = <-masterTree // update the tree with the result of 1 simulation (this will be the base)
-	close(masterTree)
-	// Collect exactly maxProcesses results from worker goroutines
-	for i := 0; i < maxProcesses; i++ {
-		dict := <-firstLayerRes
-		// Accumulate worker results into master's children
-		for _, child := range currentRoot.Children {
-			if res, exists := dict[child.Move]; exists {
-				child.Visits += res
-				// We just add visits by move because the selection of the best move just takes that into account
-				// The wins are not added because they are just used to decide the exploration/explotation in the process of estimation
-			}
-		}
-	}
-	return BestNodeFromMCTSPUCT(currentRoot)
+	best, _ := SingleRunParallelizationMCTSPUCTContext(context.Background(), currentRoot, Limits{Iterations: iterationsPerRoutine}, baseRNG)
+	return best
+}
+
+// SingleRunParallelizationMCTSPUCTContext is SingleRunParallelizationMCTSPUCT until the limits (the iterations of
+// every routine) are reached or ctx is cancelled. Returns the best move and the number of playouts of all the routines.
+func SingleRunParallelizationMCTSPUCTContext(ctx context.Context, currentRoot *PUCTNode, limits Limits, baseRNG *rand.Rand) (*PUCTNode, int) {
+	return defaultSearchPool().SingleRunParallelizationMCTSPUCTContext(ctx, currentRoot, limits, baseRNG)
 }
@@ -0,0 +1,93 @@
+package main
+
+// MCTS-Solver: the nodes whose result is known are proven, and the search uses the exact result instead of
+// the noisy one of the rollouts.
+//
+//   - A terminal node is proven when it is created, its result is the winner of the game.
+//   - A node is proven when one of its children is a win for the player to move (it will be played),
+//     or when it is fully expanded and all its children are proven (the player to move takes the best of
+//     them: a draw if there is one, otherwise it is lost).
+//   - The selection never enters a proven node: it backpropagates the proven result without a rollout.
+//     A child that is a proven loss for the player to move is only selected if there is nothing else.
+//   - The best move is a proven win if there is one, and never a proven loss if there is another move.
+//
+// The results are absolute (the winner of the game), so they do not depend on who moved into the node.
+// The searches propagate the proofs after every playout, the shared tree search (TreeParallelizationMCTSPUCT)
+// under the mutexes of the nodes (see mctsTreeParallel.go).
+
+// winFor returns the result of a game won by the player.
+func winFor(black bool) WinState {
+	if black {
+		return BLACK_WIN
+	}
+	return WHITE_WIN
+}
+
+// lossFor returns the result of a game lost by the player.
+func lossFor(black bool) WinState {
+	return winFor(!black)
+}
+
+// terminalProof returns the proof of a node created at the state: the winner if the game is over.
+func terminalProof(state State, legalMoves uint64) (result WinState, proven bool) {
+	if legalMoves == 0 && IsTerminalState(state) {
+		return WinnerState(state), true
+	}
+	return DRAW, false
+}
+
+// provenNode is a node that can be proven, see proveFromChildren.
+type provenNode interface {
+	proof() (result WinState, proven bool)
+}
+
+func (node *Node) proof() (WinState, bool) { return node.ProvenResult, node.Proven }
+
+func (node *PUCTNode) proof() (WinState, bool) { return node.ProvenResult, node.Proven }
+
+// proveFromChildren returns the result of a node from the proofs of its children, proven is false if it is not known.
+// blackTurn is the player to move at the node.
+func proveFromChildren[T provenNode](blackTurn, fullyExpanded bool, children []T) (result WinState, proven bool) {
+	win := winFor(blackTurn)
+	result, proven = lossFor(blackTurn), fullyExpanded
+	for _, child := range children {
+		childResult, childProven := child.proof()
+		switch {
+		case childProven && childResult == win:
+			return win, true
+		case !childProven:
+			proven = false
+		case childResult == DRAW:
+			result = DRAW
+		}
+	}
+	return result, proven
+}
+
+// isProvenLoss returns true if the child is a proven loss for the player that chooses it.
+func isProvenLoss[T provenNode](child T, blackTurn bool) bool {
+	result, proven := child.proof()
+	return proven && result == lossFor(blackTurn)
+}
+
+// proveAncestors proves the ancestors of the proven node that its proof decides, up to the first one that is unknown.
+func proveAncestors(node *Node) {
+	for n := node.Parent; n != nil && !n.Proven; n = n.Parent {
+		result, proven := proveFromChildren(n.GameState.BlackTurn, n.IsFullyExpanded(), n.Children)
+		if !proven {
+			return
+		}
+		n.Proven, n.ProvenResult = true, result
+	}
+}
+
+// proveAncestorsPUCT is proveAncestors for PUCTNode trees.
+func proveAncestorsPUCT(node *PUCTNode) {
+	for n := node.Parent; n != nil && !n.Proven; n = n.Parent {
+		result, proven := proveFromChildren(n.GameState.BlackTurn, n.IsFullyExpandedPUCT(), n.Children)
+		if !proven {
+			return
+		}
+		n.Proven, n.ProvenResult = true, result
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// exactResult returns the result of the state with perfect play, from the exact solver.
+func exactResult(state State) WinState {
+	score := SolveEndgame(state).Score
+	switch {
+	case score > 0:
+		return winFor(state.BlackTurn)
+	case score < 0:
+		return lossFor(state.BlackTurn)
+	}
+	return DRAW
+}
+
+func TestSearchesProveEndgames(t *testing.T) {
+	defer func(empties int) { EndgameEmpties = empties }(EndgameEmpties)
+	EndgameEmpties = 0 // The searches must prove the positions by themselves
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		state := randomPositionWithEmpties(7, rng)
+		want := exactResult(state)
+		scores := SolveMoves(state)
+
+		root := NewPUCTNode(state, nil, PASS_MOVE)
+		best, playouts := MonteCarloTreeSearchPUCTContext(context.Background(), root, Limits{Iterations: 50000}, rng)
+		if !root.Proven || root.ProvenResult != want || playouts == 50000 {
+			t.Errorf("PUCT %s: proven %v result %v after %d playouts, the solver says %v", state.PositionString(), root.Proven, root.ProvenResult, playouts, want)
+		}
+		if want == winFor(state.BlackTurn) && scores[best.Move] <= 0 {
+			t.Errorf("PUCT %s: %s does not win", state.PositionString(), MoveString(best.Move))
+		}
+
+		node := NewNode(state, nil, PASS_MOVE)
+		bestNode, playouts := OriginalMonteCarloTreeSearchContext(context.Background(), node, Limits{Iterations: 50000}, rng)
+		if !node.Proven || node.ProvenResult != want || playouts == 50000 {
+			t.Errorf("UCT %s: proven %v result %v after %d playouts, the solver says %v", state.PositionString(), node.Proven, node.ProvenResult, playouts, want)
+		}
+		if want == winFor(state.BlackTurn) && scores[bestNode.Move] <= 0 {
+			t.Errorf("UCT %s: %s does not win", state.PositionString(), MoveString(bestNode.Move))
+		}
+	}
+}
+
+func TestSharedTreeSearchProvesEndgames(t *testing.T) {
+	defer func(empties, workers int, deterministic bool) {
+		EndgameEmpties, SearchWorkers, DeterministicSearch = empties, workers, deterministic
+	}(EndgameEmpties, SearchWorkers, DeterministicSearch)
+	EndgameEmpties, SearchWorkers = 0, 4
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 10; i++ {
+		state := randomPositionWithEmpties(7, rng)
+		want := exactResult(state)
+		scores := SolveMoves(state)
+		DeterministicSearch = i%2 == 1 // The workers in turns too
+		root := NewPUCTNode(state, nil, PASS_MOVE)
+		best, playouts := TreeParallelizationMCTSPUCTContext(context.Background(), root, Limits{Iterations: 50000}, rng)
+		if !root.Proven || root.ProvenResult != want || playouts == 4*50000 {
+			t.Errorf("shared %s: proven %v result %v after %d playouts, the solver says %v", state.PositionString(), root.Proven, root.ProvenResult, playouts, want)
+		}
+		if want == winFor(state.BlackTurn) && scores[best.Move] <= 0 {
+			t.Errorf("shared %s: %s does not win", state.PositionString(), MoveString(best.Move))
+		}
+	}
+}
+
+func TestBestNodePrefersProvenWins(t *testing.T) {
+	state := InitialState()
+	state.ApplyMove(19) // d3, white has three unique moves
+	root := NewPUCTNode(state, nil, PASS_MOVE)
+	for len(root.UntriedMoves) > 0 {
+		root.ExpandPUCT()
+	}
+	loss, visited, win := root.Children[0], root.Children[1], root.Children[2]
+	loss.Visits, visited.Visits, win.Visits = 100, 50, 1
+	loss.Proven, loss.ProvenResult = true, BLACK_WIN
+	if best := BestNodeFromMCTSPUCT(root); best != visited {
+		t.Errorf("best %s, want the most visited move that is not a proven loss", MoveString(best.Move))
+	}
+	win.Proven, win.ProvenResult = true, WHITE_WIN
+	if best := BestNodeFromMCTSPUCT(root); best != win {
+		t.Errorf("best %s, want the proven win", MoveString(best.Move))
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+)
+
+// Tree parallelization: all the workers select, expand and backpropagate in the same PUCTNode tree,
+// so the knowledge deep in the tree is shared (root parallelization only merges the root children).
+// Every node has its own mutex, held only while a worker reads or updates that node, never for a whole path.
+// While a worker is below a node the node carries a virtual loss: its pending playouts count as lost
+// in the PUCT equation, so the other workers are pushed to different moves instead of all following
+// the same path.
+// The transposition table of the tree (if any) is only looked up when expanding, the shared search never stores
+// in it, so the entries do not change and its lookup counters are atomic.
+// The proofs (see mctsSolver.go) propagate as in the other searches. The proof of a node is only written
+// while holding the mutex of its parent and its own (locked in this order, the root only has its own),
+// so a worker can read it holding either of them. A proof never changes once it is written.
+
+// VIRTUAL_LOSS is the number of lost playouts a node counts for every worker searching below it.
+const VIRTUAL_LOSS = 3
+
+// bestPUCTVirtual returns the best child of the node according to the PUCT equation with the virtual losses.
+// The mutex of the node must be held.
+func bestPUCTVirtual(node *PUCTNode, c float64) *PUCTNode {
+	var bestChildNode *PUCTNode
+	bestPUCT := -math.MaxFloat64
+	totalVisitsOfNode := float64(node.Visits + int(node.virtualLoss.Load()))
+	for _, child := range node.Children {
+		move := child.Move
+		visits := float64(node.N[move])
+		virtual := float64(child.virtualLoss.Load())
+		estimatedValueOfAction := node.Q[move]
+		if virtual > 0 {
+			estimatedValueOfAction = estimatedValueOfAction * visits / (visits + virtual) // The virtual playouts are losses
+		}
+		childPUCT := estimatedValueOfAction + (c*node.P[move])*math.Sqrt(totalVisitsOfNode)/(1+visits+virtual)
+		if isProvenLoss(child, node.GameState.BlackTurn) {
+			childPUCT = -1
+		}
+		if childPUCT > bestPUCT {
+			bestPUCT = childPUCT
+			bestChildNode = child
+		}
+	}
+	return bestChildNode
+}
+
+// selectExpandShared walks the shared tree from the root to a leaf, adding a virtual loss to every node
+// of the path, and expands the leaf. Returns the node to simulate from, the number of nodes added (0 or 1)
+// and its proof: the walk stops at proven nodes, their result is known without a rollout.
+func selectExpandShared(root *PUCTNode, c float64) (leaf *PUCTNode, added int, result WinState, proven bool) {
+	node := root
+	for {
+		node.mu.Lock()
+		if node.Proven || node.IsTerminalPUCT() {
+			result, proven = node.ProvenResult, node.Proven
+			node.mu.Unlock()
+			return node, 0, result, proven
+		}
+		var next *PUCTNode
+		expanded := !node.IsFullyExpandedPUCT()
+		if expanded {
+			next = node.ExpandPUCT()
+			result, proven = next.ProvenResult, next.Proven // Read while holding the mutex of its parent
+		} else {
+			next = bestPUCTVirtual(node, c)
+		}
+		next.virtualLoss.Add(VIRTUAL_LOSS)
+		node.mu.Unlock()
+		if expanded {
+			return next, 1, result, proven
+		}
+		node = next
+	}
+}
+
+// backpropagateShared is BackpropagatePUCT for the shared tree, it also removes the virtual losses of the path.
+func backpropagateShared(root, node *PUCTNode, result WinState) {
+	for n := node; ; n = n.Parent {
+		n.mu.Lock()
+		n.Visits++
+		visits := n.Visits
+		n.mu.Unlock()
+		if n == root {
+			return
+		}
+		n.virtualLoss.Add(-VIRTUAL_LOSS)
+		p := n.Parent
+		p.mu.Lock()
+		p.N[n.Move]++
+		reward := rewardFor(p.GameState.BlackTurn, result)
+		p.Q[n.Move] += (reward - p.Q[n.Move]) / float64(visits) // Increment the running average
+		p.mu.Unlock()
+	}
+}
+
+// proveAncestorsShared is proveAncestorsPUCT for the shared tree, it stops at the root.
+func proveAncestorsShared(root, node *PUCTNode) {
+	for n := node; n != root; {
+		n = n.Parent
+		var p *PUCTNode
+		if n != root {
+			p = n.Parent
+			p.mu.Lock()
+		}
+		n.mu.Lock()
+		proven := false
+		if !n.Proven { // Otherwise another worker proved it, and the ancestors it decides
+			var result WinState
+			if result, proven = proveFromChildren(n.GameState.BlackTurn, n.IsFullyExpandedPUCT(), n.Children); proven {
+				n.Proven, n.ProvenResult = true, result
+			}
+		}
+		n.mu.Unlock()
+		if p != nil {
+			p.mu.Unlock()
+		}
+		if !proven {
+			return
+		}
+	}
+}
+
+// isProvenShared returns true if the node of the shared tree is proven.
+func isProvenShared(node *PUCTNode) bool {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.Proven
+}
+
+// playoutShared runs one playout of a worker in the shared tree and returns the number of nodes it added.
+func playoutShared(root *PUCTNode, rng *rand.Rand) int {
+	nodeToSimulateFrom, added, result, proven := selectExpandShared(root, 2.0)
+	if proven {
+		backpropagateShared(root, nodeToSimulateFrom, result) // The exact result, no rollout
+		proveAncestorsShared(root, nodeToSimulateFrom)
+	} else {
+		backpropagateShared(root, nodeToSimulateFrom, SimulateRollout(nodeToSimulateFrom.GameState, rng))
+	}
+	return added
+}
+
+// searchMCTSPUCTShared runs one worker of the shared tree search until the limits are reached and returns its playouts.
+func searchMCTSPUCTShared(ctx context.Context, root *PUCTNode, limits Limits, rng *rand.Rand) int {
+	limiter := newSearchLimiter(ctx, limits)
+	for limiter.next() {
+		limiter.played(playoutShared(root, rng))
+		if isProvenShared(root) {
+			break // The result of the game is known, the best move does not change anymore
+		}
+	}
+	return limiter.playouts
+}
+
+// searchMCTSPUCTInTurns runs the workers of the shared tree search in turns, one playout each, in this routine.
+// It is the reproducible version of the search (see DeterministicSearch). Returns the playouts of all the workers.
+func searchMCTSPUCTInTurns(ctx context.Context, root *PUCTNode, limits Limits, rngs []*rand.Rand) int {
+	limiters := make([]searchLimiter, len(rngs))
+	for i := range limiters {
+		limiters[i] = newSearchLimiter(ctx, limits)
+	}
+	playouts := 0
+	for searching := true; searching; {
+		searching = false
+		for i, rng := range rngs {
+			if !limiters[i].next() {
+				continue
+			}
+			searching = true
+			limiters[i].played(playoutShared(root, rng))
+			playouts++
+			if root.Proven {
+				return playouts // The result of the game is known, the best move does not change anymore
+			}
+		}
+	}
+	return playouts
+}
+
+// TreeParallelizationMCTSPUCT is a tree level parallelization of MCTS PUCT.
+// The workers (see SearchWorkers) search the same tree, using virtual loss to spread over different moves.
+func TreeParallelizationMCTSPUCT(currentRoot *PUCTNode, iterationsPerRoutine int, baseRNG *rand.Rand) *PUCTNode {
+	best, _ := TreeParallelizationMCTSPUCTContext(context.Background(), currentRoot, Limits{Iterations: iterationsPerRoutine}, baseRNG)
+	return best
+}
+
+// TreeParallelizationMCTSPUCTContext is TreeParallelizationMCTSPUCT until the limits (the iterations of
+// every routine) are reached or ctx is cancelled. Returns the best move and the number of playouts of all the routines.
+func TreeParallelizationMCTSPUCTContext(ctx context.Context, currentRoot *PUCTNode, limits Limits, baseRNG *rand.Rand) (*PUCTNode, int) {
+	if currentRoot.IsTerminalPUCT() {
+		return currentRoot, 0
+	}
+	if limits.solves(currentRoot.GameState) {
+		if best := solvedBestNodePUCTWithin(ctx, currentRoot, limits); best != nil {
+			return best, 0
+		}
+	}
+	workers := searchWorkers()
+	limits = limits.perRoutine(workers)
+	seed := baseRNG.Int63()
+	rngs := make([]*rand.Rand, workers) // Every worker has its own rng, split from the base one
+	for i := range rngs {
+		rngs[i] = NewStreamRNG(seed, i)
+	}
+	if DeterministicSearch {
+		playouts := searchMCTSPUCTInTurns(ctx, currentRoot, limits, rngs)
+		return BestNodeFromMCTSPUCT(currentRoot), playouts
+	}
+	results := make(chan int, workers)
+	for _, workerRNG := range rngs {
+		go func() {
+			results <- searchMCTSPUCTShared(ctx, currentRoot, limits, workerRNG)
+		}()
+	}
+	playouts := 0
+	for range rngs {
+		playouts += <-results
+	}
+	return BestNodeFromMCTSPUCT(currentRoot), playouts
+}
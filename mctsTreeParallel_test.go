@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func TestTreeParallelizationVisits(t *testing.T) {
+	state := InitialRootPUCTNode().GameState
+	state.ApplyMove(19) // d3, white has several unique moves
+	root := NewPUCTNode(state, nil, PASS_MOVE)
+	best, playouts := TreeParallelizationMCTSPUCTContext(context.Background(), root, Limits{Iterations: 300}, rand.New(rand.NewSource(1)))
+	if playouts == 0 || root.Visits != playouts {
+		t.Fatalf("root visits %d after %d playouts", root.Visits, playouts)
+	}
+	if best == nil || best.Parent != root {
+		t.Fatal("the best node is not a child of the root")
+	}
+	children := 0
+	for _, child := range root.Children {
+		children += root.N[child.Move]
+		if child.Visits != root.N[child.Move] {
+			t.Errorf("child %s has %d visits, the root counts %d", MoveString(child.Move), child.Visits, root.N[child.Move])
+		}
+		if loss := child.virtualLoss.Load(); loss != 0 {
+			t.Errorf("child %s kept a virtual loss of %d", MoveString(child.Move), loss)
+		}
+	}
+	if children != playouts {
+		t.Errorf("children visits %d after %d playouts", children, playouts)
+	}
+}
+
+func TestTreeParallelizationWithTable(t *testing.T) {
+	defer func(workers int) { SearchWorkers = workers }(SearchWorkers)
+	SearchWorkers = 4
+	rng := rand.New(rand.NewSource(1))
+	table := NewMCTSTable(1 << 12)
+	filled := InitialRootPUCTNode()
+	filled.Table = table
+	RootAfterMCTSPUCTContext(context.Background(), filled, Limits{Iterations: 300}, rng) // The table knows some positions
+
+	// The workers look up the positions at the same time, run with -race
+	root := InitialRootPUCTNode()
+	root.Table = table
+	probes, stores := table.Probes.Load(), table.Stores
+	TreeParallelizationMCTSPUCTContext(context.Background(), root, Limits{Iterations: 200}, rng)
+	if got, want := table.Probes.Load()-probes, int64(countPUCTNodes(root)-1); got != want {
+		t.Errorf("%d lookups for %d expanded nodes", got, want)
+	}
+	if table.Stores != stores {
+		t.Errorf("the shared search stored %d entries", table.Stores-stores)
+	}
+	if table.Hits.Load() == 0 {
+		t.Error("the shared search found no known position")
+	}
+}
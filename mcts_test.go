@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func TestLeafParallelizationVisits(t *testing.T) {
+	state := InitialRootNode().GameState
+	state.ApplyMove(19) // d3, white has several unique moves
+	root := NewNode(state, nil, PASS_MOVE)
+	best, playouts := LeafParallelizationMCTSContext(context.Background(), root, Limits{Iterations: 100}, rand.New(rand.NewSource(1)))
+	if want := 100 * searchWorkers(); playouts != want || root.Visits != playouts {
+		t.Fatalf("root visits %d after %d playouts, want %d", root.Visits, playouts, want)
+	}
+	if best == nil || best.Parent != root {
+		t.Fatal("the best node is not a child of the root")
+	}
+	visits, wins := 0, 0
+	for _, child := range root.Children {
+		visits += child.Visits
+		wins += child.Wins
+	}
+	if visits != playouts || wins > visits {
+		t.Errorf("children have %d visits and %d wins after %d playouts", visits, wins, playouts)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+// Move generation with Kogge-Stone occluded fills.
+// Dumb7fill (see Dumb7fillMoves) shifts the disks one square at a time, 7 times per direction.
+// Kogge-Stone propagates in steps of 1, 2 and 4 squares (parallel prefix) so 3 steps are enough,
+// and every direction uses constant shifts and masks so there are no lookups.
+
+// MoveGenerator is the implementation used by generateMoves to get the legal moves bitboard.
+// FlipCalculator is the implementation used by Flips (and so ResolveMove) to get the captured disks.
+// Both can be switched to compare implementations, but not while a search is running.
+var (
+	MoveGenerator  func(myDisks, oppDisks uint64) uint64                  = KoggeStoneMoves
+	FlipCalculator func(myDisks, oppDisks uint64, moveIndex uint8) uint64 = KoggeStoneFlips
+)
+
+// UseDumb7fill selects the original Dumb7fill implementations for generateMoves and Flips.
+func UseDumb7fill() {
+	MoveGenerator = Dumb7fillMoves
+	FlipCalculator = Dumb7fillFlips
+}
+
+// UseKoggeStone selects the Kogge-Stone implementations for generateMoves and Flips (the default).
+func UseKoggeStone() {
+	MoveGenerator = KoggeStoneMoves
+	FlipCalculator = KoggeStoneFlips
+}
+
+// Masks of the squares that can receive a disk after shifting, so that the rows do not wrap around.
+const (
+	notColumnA = 0xFEFEFEFEFEFEFEFE // After shifting towards higher columns
+	notColumnH = 0x7F7F7F7F7F7F7F7F // After shifting towards lower columns
+	allSquares = 0xFFFFFFFFFFFFFFFF
+)
+
+// fillLeft returns gen extended (in the direction of the left shift) over the consecutive squares of pro.
+// mask removes the squares where a shift wraps around the board.
+func fillLeft(gen, pro uint64, shift uint, mask uint64) uint64 {
+	pro &= mask
+	gen |= pro & (gen << shift)
+	pro &= pro << shift
+	gen |= pro & (gen << (2 * shift))
+	pro &= pro << (2 * shift)
+	gen |= pro & (gen << (4 * shift))
+	return gen
+}
+
+// fillRight is fillLeft for the directions that shift right.
+func fillRight(gen, pro uint64, shift uint, mask uint64) uint64 {
+	pro &= mask
+	gen |= pro & (gen >> shift)
+	pro &= pro >> shift
+	gen |= pro & (gen >> (2 * shift))
+	pro &= pro >> (2 * shift)
+	gen |= pro & (gen >> (4 * shift))
+	return gen
+}
+
+// movesLeft returns the legal moves in one direction that shifts left.
+func movesLeft(myDisks, oppDisks, empty uint64, shift uint, mask uint64) uint64 {
+	runs := fillLeft(myDisks, oppDisks, shift, mask) &^ myDisks // Opponent disks next to ours
+	return (runs << shift) & mask & empty
+}
+
+// movesRight returns the legal moves in one direction that shifts right.
+func movesRight(myDisks, oppDisks, empty uint64, shift uint, mask uint64) uint64 {
+	runs := fillRight(myDisks, oppDisks, shift, mask) &^ myDisks
+	return (runs >> shift) & mask & empty
+}
+
+// KoggeStoneMoves returns a bitboard where the 1s represent valid places to put the disk (same as Dumb7fillMoves).
+func KoggeStoneMoves(myDisks, oppDisks uint64) uint64 {
+	empty := ^(myDisks | oppDisks)
+	return movesLeft(myDisks, oppDisks, empty, 1, notColumnA) |
+		movesRight(myDisks, oppDisks, empty, 1, notColumnH) |
+		movesLeft(myDisks, oppDisks, empty, 8, allSquares) |
+		movesRight(myDisks, oppDisks, empty, 8, allSquares) |
+		movesLeft(myDisks, oppDisks, empty, 9, notColumnA) |
+		movesRight(myDisks, oppDisks, empty, 9, notColumnH) |
+		movesLeft(myDisks, oppDisks, empty, 7, notColumnH) |
+		movesRight(myDisks, oppDisks, empty, 7, notColumnA)
+}
+
+// flipsLeft returns the disks captured in one direction that shifts left, starting from newDisk.
+func flipsLeft(myDisks, oppDisks, newDisk uint64, shift uint, mask uint64) uint64 {
+	run := fillLeft(newDisk, oppDisks, shift, mask) &^ newDisk
+	if ((run|newDisk)<<shift)&mask&myDisks == 0 {
+		return 0 // The run of opponent disks is not closed by one of ours
+	}
+	return run
+}
+
+// flipsRight returns the disks captured in one direction that shifts right, starting from newDisk.
+func flipsRight(myDisks, oppDisks, newDisk uint64, shift uint, mask uint64) uint64 {
+	run := fillRight(newDisk, oppDisks, shift, mask) &^ newDisk
+	if ((run|newDisk)>>shift)&mask&myDisks == 0 {
+		return 0
+	}
+	return run
+}
+
+// KoggeStoneFlips returns the opponent disks captured by the move (same as Dumb7fillFlips).
+func KoggeStoneFlips(myDisks, oppDisks uint64, moveIndex uint8) uint64 {
+	newDisk := uint64(1) << moveIndex
+	return flipsLeft(myDisks, oppDisks, newDisk, 1, notColumnA) |
+		flipsRight(myDisks, oppDisks, newDisk, 1, notColumnH) |
+		flipsLeft(myDisks, oppDisks, newDisk, 8, allSquares) |
+		flipsRight(myDisks, oppDisks, newDisk, 8, allSquares) |
+		flipsLeft(myDisks, oppDisks, newDisk, 9, notColumnA) |
+		flipsRight(myDisks, oppDisks, newDisk, 9, notColumnH) |
+		flipsLeft(myDisks, oppDisks, newDisk, 7, notColumnH) |
+		flipsRight(myDisks, oppDisks, newDisk, 7, notColumnA)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// randomDisjointBoards returns two random disjoint bitboards, roughly half of the squares are occupied.
+func randomDisjointBoards(rng *rand.Rand) (uint64, uint64) {
+	occupied := rng.Uint64() | rng.Uint64()&rng.Uint64() // Around 5/8 of the squares
+	colors := rng.Uint64()
+	return occupied & colors, occupied &^ colors
+}
+
+func TestKoggeStoneAgreesWithDumb7fill(t *testing.T) {
+	positions := 2000000
+	if testing.Short() {
+		positions = 100000
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < positions; i++ {
+		myDisks, oppDisks := randomDisjointBoards(rng)
+		want := Dumb7fillMoves(myDisks, oppDisks)
+		got := KoggeStoneMoves(myDisks, oppDisks)
+		if got != want {
+			t.Fatalf("moves of my=%#x opp=%#x: Kogge-Stone %#x, Dumb7fill %#x", myDisks, oppDisks, got, want)
+		}
+		for m := want; m != 0; m &= m - 1 {
+			move := uint8(bits.TrailingZeros64(m))
+			wantFlips := Dumb7fillFlips(myDisks, oppDisks, move)
+			gotFlips := KoggeStoneFlips(myDisks, oppDisks, move)
+			if gotFlips != wantFlips {
+				t.Fatalf("flips of move %d my=%#x opp=%#x: Kogge-Stone %#x, Dumb7fill %#x", move, myDisks, oppDisks, gotFlips, wantFlips)
+			}
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NBoard protocol: the NBoard GUI runs the engine and talks to it with one command per line on stdin/stdout.
+// The commands handled are:
+//
+//	nboard <version>   the engine answers with set myname <name>
+//	set depth <n>      search strength, from 1 to 60 (the iterations are n * IterationsPerDepth)
+//	set game <ggf>     the game so far, in GGF (see ggf.go)
+//	set contempt <n>   ignored
+//	move <move>        a move played (by any side), like F5/0.50/1.2
+//	hint <n>           the engine answers with a search line for its n best moves between status lines
+//	go                 the engine answers === <move>/<eval>/<time> (the GUI then sends it back with move)
+//	ping <n>           the engine answers pong <n> once everything before was processed
+//	learn              the engine answers learned
+//	quit               the engine stops
+//
+// Evaluations are from the point of view of the side to move. Exact scores come from the endgame solver,
+// otherwise the MCTS win rate is scaled to [-64, 64] so that NBoard can show it like a disc evaluation.
+// The solves stop after SolveTime, the moves are searched instead then.
+
+// NBOARD_DEFAULT_DEPTH is the depth used until NBoard sends set depth.
+const NBOARD_DEFAULT_DEPTH = 20
+
+// NBOARD_SOLVE_TIME is the default time that the solves of a position may take.
+const NBOARD_SOLVE_TIME = 10 * time.Second
+
+// NBoardEngine keeps the game and the search settings of an NBoard session.
+type NBoardEngine struct {
+	Name               string
+	Search             puctSearch // Runs without the solver, analyze solves the endgames itself
+	IterationsPerDepth int
+	Depth              int
+	SolveTime          time.Duration // Time the solves of a position may take
+	node               *PUCTNode     // Current position, its tree is kept between moves
+	rng                *rand.Rand
+	out                io.Writer
+}
+
+// NewNBoardEngine returns an engine that plays with SingleRunParallelizationMCTSPUCT and writes its answers to out.
+func NewNBoardEngine(out io.Writer, rng *rand.Rand) *NBoardEngine {
+	return &NBoardEngine{
+		Name:               "othello-mcts",
+		Search:             NewSearchPool(SearchWorkers, rng).SingleRunParallelizationMCTSPUCTContext,
+		IterationsPerDepth: 100,
+		Depth:              NBOARD_DEFAULT_DEPTH,
+		SolveTime:          NBOARD_SOLVE_TIME,
+		node:               InitialRootPUCTNode(),
+		rng:                rng,
+		out:                out,
+	}
+}
+
+// RunNBoard reads NBoard commands from in until quit or the end of the input.
+func RunNBoard(in io.Reader, engine *NBoardEngine) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // A GGF game can be a long line
+	for scanner.Scan() {
+		if engine.HandleCommand(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// HandleCommand runs one NBoard command. Returns true if the command is quit.
+// Errors (like an invalid move) are reported to NBoard with a status line.
+func (e *NBoardEngine) HandleCommand(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	var err error
+	switch fields[0] {
+	case "nboard":
+		e.send("set myname %s", e.Name)
+	case "set":
+		err = e.handleSet(fields[1:], line)
+	case "move":
+		err = e.handleMove(fields[1:])
+	case "hint":
+		err = e.handleHint(fields[1:])
+	case "go":
+		e.handleGo()
+	case "ping":
+		e.send("pong %s", strings.Join(fields[1:], " "))
+	case "learn":
+		e.send("learned")
+	case "quit":
+		return true
+	}
+	if err != nil {
+		e.send("status Error: %v", err)
+	}
+	return false
+}
+
+// send writes one line to NBoard.
+func (e *NBoardEngine) send(format string, args ...any) {
+	fmt.Fprintf(e.out, format+"\n", args...)
+}
+
+// handleSet handles set depth, set game and set contempt.
+func (e *NBoardEngine) handleSet(args []string, line string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing set argument")
+	}
+	switch args[0] {
+	case "depth":
+		if len(args) < 2 {
+			return fmt.Errorf("missing depth")
+		}
+		depth, err := strconv.Atoi(args[1])
+		if err != nil || depth < 1 || depth > 60 {
+			return fmt.Errorf("invalid depth %q", args[1])
+		}
+		e.Depth = depth
+	case "game":
+		ggf := line[strings.Index(line, "game")+len("game"):]
+		game, err := ParseGGF(ggf)
+		if err != nil {
+			return err
+		}
+		node, err := puctNodeFromGGF(&game)
+		if err != nil {
+			return err
+		}
+		e.node = node
+	}
+	return nil
+}
+
+// puctNodeFromGGF returns the node of the position at the end of the moves of a GGF game.
+func puctNodeFromGGF(game *GGFGame) (*PUCTNode, error) {
+	var node *PUCTNode
+	if game.Start == InitialState() {
+		node = InitialRootPUCTNode()
+	} else {
+		start := game.Start
+		if !start.Boards.HasValidMove(start.BlackTurn) && start.Boards.HasValidMove(!start.BlackTurn) {
+			start.BlackTurn = !start.BlackTurn // The nodes pass automatically
+		}
+		start.Hash = start.Boards.ZobristHash(start.BlackTurn)
+		var emptyMove uint8
+		node = NewPUCTNode(start, nil, emptyMove)
+	}
+	for _, move := range game.Moves {
+		if move.Move == PASS_MOVE {
+			continue // The nodes pass automatically
+		}
+		next, err := TryNextPUCTNodeFromInput(node, move.Move)
+		if err != nil {
+			return nil, err
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// handleMove plays a move of any side in the current game.
+func (e *NBoardEngine) handleMove(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing move")
+	}
+	move, err := parseGGFMove(args[0])
+	if err != nil {
+		return err
+	}
+	if move.Move == PASS_MOVE {
+		return nil // The nodes pass automatically
+	}
+	next, err := TryNextPUCTNodeFromInput(e.node, move.Move)
+	if err != nil {
+		return err
+	}
+	e.node = next
+	return nil
+}
+
+// handleGo searches the current position and sends the chosen move.
+// The position does not change until NBoard sends the move back.
+func (e *NBoardEngine) handleGo() {
+	state := e.node.GameState
+	if IsTerminalState(state) || !state.Boards.HasValidMove(state.BlackTurn) {
+		e.send("=== PA")
+		return
+	}
+	start := time.Now()
+	hints := e.analyze()
+	best := hints[0]
+	e.send("=== %s/%.2f/%.2f", strings.ToUpper(MoveString(best.Move)), best.Eval, time.Since(start).Seconds())
+}
+
+// nboardHint is the evaluation of a move for the hint command.
+type nboardHint struct {
+	Move   uint8
+	Eval   float64
+	Visits int
+	Exact  bool // Eval is the exact disc differential
+}
+
+// handleHint sends the evaluation of the best n moves of the current position.
+func (e *NBoardEngine) handleHint(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing number of hints")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid number of hints %q", args[0])
+	}
+	state := e.node.GameState
+	if IsTerminalState(state) {
+		return nil
+	}
+	e.send("status Analyzing")
+	hints := e.analyze()
+	for i := 0; i < n && i < len(hints); i++ {
+		depth := strconv.Itoa(e.Depth)
+		if hints[i].Exact {
+			depth = "100%"
+		}
+		e.send("search %s %.2f 0 %s", strings.ToUpper(MoveString(hints[i].Move)), hints[i].Eval, depth)
+	}
+	e.send("status")
+	return nil
+}
+
+// analyze evaluates the moves of the current position and returns them from best to worst.
+// Close to the end every move is solved (if the solves finish within SolveTime), otherwise the search runs
+// and the moves are ordered by visits.
+func (e *NBoardEngine) analyze() []nboardHint {
+	state := e.node.GameState
+	var hints []nboardHint
+	if ShouldSolve(state) {
+		limits := Limits{Deadline: time.Now().Add(e.SolveTime)}
+		if scores, err := SolveMovesContext(context.Background(), state, limits); err == nil {
+			for move, score := range scores {
+				hints = append(hints, nboardHint{Move: move, Eval: float64(score), Exact: true})
+			}
+			sort.Slice(hints, func(i, j int) bool {
+				return hints[i].Eval > hints[j].Eval || (hints[i].Eval == hints[j].Eval && hints[i].Move < hints[j].Move)
+			})
+			return hints
+		}
+	}
+
+	best, _ := e.Search(context.Background(), e.node, Limits{Iterations: e.Depth * e.IterationsPerDepth, NoSolver: true}, e.rng)
+	for _, child := range e.node.Children {
+		// The search only keeps one of the symmetric moves, they all get its evaluation
+		for _, move := range state.Boards.SymmetricMoves(child.Move) {
+			hints = append(hints, nboardHint{
+				Move:   move,
+				Eval:   64 * (2*e.node.Q[child.Move] - 1),
+				Visits: child.Visits,
+			})
+		}
+	}
+	sort.SliceStable(hints, func(i, j int) bool { return hints[i].Visits > hints[j].Visits })
+	// The chosen move goes first even if the search chose it by other criteria
+	for i := range hints {
+		if hints[i].Move == best.Move {
+			chosen := hints[i]
+			copy(hints[1:i+1], hints[:i])
+			hints[0] = chosen
+			return hints
+		}
+	}
+	// The search did not leave its statistics in the tree, only its choice is known
+	return append([]nboardHint{{Move: best.Move}}, hints...)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNBoard is a scripted GUI talking to an engine over pipes.
+type fakeNBoard struct {
+	t       *testing.T
+	toEng   *io.PipeWriter
+	fromEng *bufio.Scanner
+	done    chan error
+}
+
+func newFakeNBoard(t *testing.T) *fakeNBoard {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	engine := NewNBoardEngine(outWriter, rand.New(rand.NewSource(1)))
+	engine.Search = MonteCarloTreeSearchPUCTContext
+	engine.IterationsPerDepth = 10
+	gui := &fakeNBoard{t: t, toEng: inWriter, fromEng: bufio.NewScanner(outReader), done: make(chan error, 1)}
+	go func() {
+		err := RunNBoard(inReader, engine)
+		outWriter.Close()
+		gui.done <- err
+	}()
+	return gui
+}
+
+// send writes a command to the engine.
+func (g *fakeNBoard) send(command string) {
+	if _, err := io.WriteString(g.toEng, command+"\n"); err != nil {
+		g.t.Fatal(err)
+	}
+}
+
+// expect reads the next line of the engine and checks its prefix.
+func (g *fakeNBoard) expect(prefix string) string {
+	g.t.Helper()
+	if !g.fromEng.Scan() {
+		g.t.Fatalf("engine closed its output, want %q", prefix)
+	}
+	line := g.fromEng.Text()
+	if !strings.HasPrefix(line, prefix) {
+		g.t.Fatalf("engine sent %q, want %q", line, prefix)
+	}
+	return line
+}
+
+func TestNBoardSession(t *testing.T) {
+	gui := newFakeNBoard(t)
+	gui.send("nboard 2")
+	gui.expect("set myname ")
+	gui.send("set depth 5")
+	gui.send("set game (;GM[Othello]PC[NBoard]PB[human]PW[engine]RE[?]TI[5:00]TY[8]" +
+		"BO[8 -------- -------- -------- ---O*--- ---*O--- -------- -------- -------- *]B[F5//1.2];)")
+	gui.send("ping 1")
+	gui.expect("pong 1")
+
+	gui.send("go")
+	answer := gui.expect("=== ")
+	move, err := parseGGFMove(strings.TrimPrefix(answer, "=== "))
+	if err != nil {
+		t.Fatalf("engine move %q: %v", answer, err)
+	}
+	if move.Move != 43 && move.Move != 45 && move.Move != 29 { // d6, f6, f4
+		t.Errorf("engine played %s, not a legal reply to f5", MoveString(move.Move))
+	}
+	gui.send("move " + MoveString(move.Move))
+	gui.send("hint 2")
+	gui.expect("status Analyzing")
+	gui.expect("search ")
+	gui.expect("search ")
+	gui.expect("status")
+
+	gui.send("move a1")
+	gui.expect("status Error")
+	gui.send("ping 2")
+	gui.expect("pong 2")
+	gui.send("quit")
+	if gui.fromEng.Scan() {
+		t.Errorf("engine sent %q after quit", gui.fromEng.Text())
+	}
+	if err := <-gui.done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNBoardEndgameHints(t *testing.T) {
+	var out strings.Builder
+	engine := NewNBoardEngine(&out, rand.New(rand.NewSource(1)))
+	state := randomPositionWithEmpties(10, rand.New(rand.NewSource(5)))
+	game := GGFGame{Start: state}
+	engine.HandleCommand("set game " + game.String())
+	engine.HandleCommand("hint 1")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[1], " 100%") {
+		t.Fatalf("hint output = %q", lines)
+	}
+	fields := strings.Fields(lines[1])
+	if want := fmt.Sprintf("%.2f", float64(SolveEndgame(state).Score)); fields[2] != want {
+		t.Errorf("hint %q, want the solver score %s", lines[1], want)
+	}
+}
+
+func TestNBoardHintsSymmetricMoves(t *testing.T) {
+	var out strings.Builder
+	engine := NewNBoardEngine(&out, rand.New(rand.NewSource(1)))
+	engine.HandleCommand("set depth 1")
+	engine.HandleCommand("hint 4")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("hints of the 4 opening moves = %q", lines)
+	}
+	seen := map[string]bool{}
+	for _, line := range lines[1:5] {
+		seen[strings.Fields(line)[1]] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("hints of the opening = %q, want the 4 moves", lines)
+	}
+}
+
+func TestNBoardHintsSearchWhenTheSolveDoesNotFit(t *testing.T) {
+	var out strings.Builder
+	engine := NewNBoardEngine(&out, rand.New(rand.NewSource(1)))
+	engine.SolveTime = 10 * time.Millisecond
+	engine.HandleCommand("set depth 1")
+	state := randomPositionWithEmpties(EndgameEmpties, rand.New(rand.NewSource(4)))
+	game := GGFGame{Start: state}
+	engine.HandleCommand("set game " + game.String())
+	start := time.Now()
+	engine.HandleCommand("hint 1")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the hint took %s with 10ms to solve", elapsed)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || strings.HasSuffix(lines[1], " 100%") {
+		t.Errorf("hint output = %q, want the search", lines)
+	}
+}
@@ -10,46 +10,47 @@ type Node struct {
 	Visits       int
 	Wins         int
 	Move         uint8
+	Table        *MCTSTable // Optional transposition table shared by the whole tree (nil to disable)
+	Proven       bool       // The result of the game from this node is known (see mctsSolver.go)
+	ProvenResult WinState   // The known result, only valid if Proven
 }
 
 // InitialRootNode returns a Node with the start of the game prepared
 func InitialRootNode() *Node {
-	var node *Node
-	var boards Board
-	boards.Init()
-	var state State
-	state.Boards = boards
-	state.BlackTurn = true
 	var emptyMove uint8
-	node = NewNode(state, nil, emptyMove)
-	return node
+	return NewNode(InitialState(), nil, emptyMove)
 }
 
 // NextNodeFromInput returns the next node (subtree) given the index of the move to be made from the current.
+// It panics if the move is not valid, use TryNextNodeFromInput for moves that come from the user.
 func NextNodeFromInput(parent *Node, moveIndex uint8) *Node {
+	node, err := TryNextNodeFromInput(parent, moveIndex)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// TryNextNodeFromInput returns the next node (subtree) given the index of the move to be made from the current,
+// or an error if the move cannot be made (see State.TryMove).
+func TryNextNodeFromInput(parent *Node, moveIndex uint8) (*Node, error) {
 
 	// If the move exists in a subtree cut that subtree and preserve it, to preserve the information of previous simulations
 	for _, child := range parent.Children {
 		if child.Move == moveIndex {
 			child.Parent = nil
-			return child
+			return child, nil
 		}
 	}
-	newBoards := parent.GameState.Boards                           // Copy
-	newBoards.MakeMoveIndex(parent.GameState.BlackTurn, moveIndex) // We make the move on the current player
-	newState := State{
-		Boards:    newBoards,
-		BlackTurn: !parent.GameState.BlackTurn, // switch turn immediately
-	}
-	// Switch turn but conditionally to deal with edgecase of the opponent having no moves.
-	if !newState.Boards.HasValidMove(newState.BlackTurn) && newState.Boards.HasValidMove(!newState.BlackTurn) {
-		//fmt.Println("No valid moves for next player — passing turn back.")
-		newState.BlackTurn = !newState.BlackTurn
+	newState := parent.GameState // Copy
+	if err := newState.TryMove(newState.BlackTurn, moveIndex); err != nil {
+		return nil, err
 	}
-	return NewNode(newState, parent, moveIndex)
+	return NewNode(newState, parent, moveIndex), nil
 }
 
 // NewNode returns a new node, setting the minimal variables (none mcts).
+// The node shares the transposition table of its parent.
 func NewNode(state State, parent *Node, move uint8) *Node {
 	var legalMoves uint64
 	if state.BlackTurn {
@@ -57,14 +58,22 @@ func NewNode(state State, parent *Node, move uint8) *Node {
 	} else {
 		legalMoves = generateMoves(state.Boards.White, state.Boards.Black)
 	}
-	movesFromCurrent := FastArrayOfMoves(legalMoves)
+	movesFromCurrent := state.Boards.treeMoves(legalMoves) // Symmetric moves are the same game, keep one
 
+	var table *MCTSTable
+	if parent != nil {
+		table = parent.Table
+	}
+	result, proven := terminalProof(state, legalMoves)
 	return &Node{
 		Parent:       parent,
 		GameState:    state,
 		Move:         move,
 		UntriedMoves: movesFromCurrent,
 		Children:     []*Node{},
+		Table:        table,
+		Proven:       proven,
+		ProvenResult: result,
 	}
 }
 
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Moves are written in the standard Othello coordinates: the column as a letter (a to h) followed
+// by the row as a number (1 to 8), so index 0 is a1 and index 63 is h8. A pass is written PS.
+// A game transcript is the moves one after the other without separators, like f5d6c3d3c4.
+
+// ErrInvalidMove is returned when a move in text cannot be parsed.
+var ErrInvalidMove = errors.New("invalid move notation")
+
+// MoveString returns the move index (or PASS_MOVE) in standard notation, like d3 or PS.
+func MoveString(move uint8) string {
+	if move == PASS_MOVE {
+		return "PS"
+	}
+	if move >= 64 {
+		return fmt.Sprintf("?%d", move)
+	}
+	row := move >> 3 // Faster division by 8
+	col := move & 7  // Faster modulo 8
+	return string([]byte{'a' + col, '1' + row})
+}
+
+// ParseMove returns the move index of a move in standard notation (case insensitive).
+// PS, PA, pass and -- are accepted for a pass and give PASS_MOVE.
+func ParseMove(text string) (uint8, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	switch text {
+	case "ps", "pa", "pass", "--":
+		return PASS_MOVE, nil
+	}
+	if len(text) != 2 || text[0] < 'a' || text[0] > 'h' || text[1] < '1' || text[1] > '8' {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMove, text)
+	}
+	col := text[0] - 'a'
+	row := text[1] - '1'
+	return row*8 + col, nil
+}
+
+// MovesString returns a transcript of the moves, like f5d6c3.
+func MovesString(moves []uint8) string {
+	var sb strings.Builder
+	sb.Grow(2 * len(moves))
+	for _, move := range moves {
+		sb.WriteString(MoveString(move))
+	}
+	return sb.String()
+}
+
+// ParseMoves returns the moves of a transcript. Moves can be separated by spaces or not.
+func ParseMoves(text string) ([]uint8, error) {
+	text = strings.Join(strings.Fields(text), "")
+	if len(text)%2 != 0 {
+		return nil, fmt.Errorf("%w: odd length transcript %q", ErrInvalidMove, text)
+	}
+	moves := make([]uint8, 0, len(text)/2)
+	for i := 0; i < len(text); i += 2 {
+		move, err := ParseMove(text[i : i+2])
+		if err != nil {
+			return nil, err
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
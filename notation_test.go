@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMoveNotationRoundTrip(t *testing.T) {
+	for move := uint8(0); move <= PASS_MOVE; move++ {
+		parsed, err := ParseMove(MoveString(move))
+		if err != nil || parsed != move {
+			t.Errorf("ParseMove(MoveString(%d)) = %d, %v", move, parsed, err)
+		}
+	}
+	if got := MoveString(0); got != "a1" {
+		t.Errorf("MoveString(0) = %q, want a1", got)
+	}
+	if got := MoveString(63); got != "h8" {
+		t.Errorf("MoveString(63) = %q, want h8", got)
+	}
+	if move, err := ParseMove("D3"); err != nil || move != 19 {
+		t.Errorf("ParseMove(D3) = %d, %v, want 19", move, err)
+	}
+	for _, text := range []string{"", "i1", "a9", "a0", "d", "d33", "xx"} {
+		if _, err := ParseMove(text); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("ParseMove(%q) error = %v, want ErrInvalidMove", text, err)
+		}
+	}
+}
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	transcript := "f5d6c3d3c4f4PSc5"
+	moves, err := ParseMoves(transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 8 || moves[6] != PASS_MOVE {
+		t.Fatalf("ParseMoves(%q) = %v", transcript, moves)
+	}
+	if got := MovesString(moves); got != transcript {
+		t.Errorf("MovesString = %q, want %q", got, transcript)
+	}
+	if _, err := ParseMoves("f5d"); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("ParseMoves(f5d) error = %v, want ErrInvalidMove", err)
+	}
+}
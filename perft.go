@@ -0,0 +1,92 @@
+package main
+
+import "math/bits"
+
+// Perft (performance test) counts the leaf nodes of the game tree up to a given depth.
+// The counts from the starting position are well known, so they check that move generation,
+// captures and passes are correct. A pass counts as a ply, and a game that ends before the
+// depth is reached counts as a single leaf.
+
+// PerftResults are the known perft counts from the starting position, PerftResults[depth].
+var PerftResults = []uint64{
+	1,
+	4,
+	12,
+	56,
+	244,
+	1396,
+	8200,
+	55092,
+	390216,
+	3005288,
+	24571284,
+	212258800,
+	1939886636,
+	18429641748,
+}
+
+// Perft returns the number of leaf nodes at the given depth from the state.
+func Perft(state State, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	return perft(&state, depth)
+}
+
+// PerftDivide returns the perft count of every legal move of the state (at depth - 1 after the move).
+// Comparing it with a correct implementation shows in which subtree the error is.
+func PerftDivide(state State, depth int) map[uint8]uint64 {
+	divide := make(map[uint8]uint64)
+	if depth == 0 || IsTerminalState(state) {
+		return divide
+	}
+	for _, move := range FastArrayOfMoves(legalMovesOf(state)) {
+		record := state.applyMove(move)
+		divide[move] = perftAfterMove(&state, record, depth)
+		state.Unmake(record)
+	}
+	return divide
+}
+
+// legalMovesOf returns the bitboard of the legal moves of the player in turn.
+func legalMovesOf(state State) uint64 {
+	if state.BlackTurn {
+		return generateMoves(state.Boards.Black, state.Boards.White)
+	}
+	return generateMoves(state.Boards.White, state.Boards.Black)
+}
+
+// perft counts the leaves below the state, depth must be at least 1.
+// The state is modified during the search but restored before returning.
+func perft(state *State, depth int) uint64 {
+	if IsTerminalState(*state) {
+		return 1
+	}
+	moves := legalMovesOf(*state)
+	if depth == 1 {
+		return uint64(bits.OnesCount64(moves)) // Bulk counting, the moves are the leaves
+	}
+	var nodes uint64
+	for m := moves; m != 0; m &= m - 1 {
+		record := state.applyMove(uint8(bits.TrailingZeros64(m)))
+		nodes += perftAfterMove(state, record, depth)
+		state.Unmake(record)
+	}
+	return nodes
+}
+
+// perftAfterMove counts the leaves below a move made at the given depth.
+// applyMove hides the pass of the opponent (the turn comes back), but for perft it is one more ply.
+func perftAfterMove(state *State, record MoveRecord, depth int) uint64 {
+	depth--
+	if state.BlackTurn == record.BlackTurn && !IsTerminalState(*state) {
+		if depth == 0 {
+			return 1
+		}
+		depth-- // The opponent passed
+	}
+	if depth == 0 {
+		return 1
+	}
+	return perft(state, depth)
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestPerft(t *testing.T) {
+	maxDepth := 11
+	if testing.Short() {
+		maxDepth = 9
+	}
+	for depth := 1; depth <= maxDepth; depth++ {
+		if got := Perft(InitialState(), depth); got != PerftResults[depth] {
+			t.Errorf("perft(%d) = %d, want %d", depth, got, PerftResults[depth])
+		}
+	}
+}
+
+func TestPerftDumb7fill(t *testing.T) {
+	UseDumb7fill()
+	defer UseKoggeStone()
+	for depth := 1; depth <= 8; depth++ {
+		if got := Perft(InitialState(), depth); got != PerftResults[depth] {
+			t.Errorf("perft(%d) = %d, want %d", depth, got, PerftResults[depth])
+		}
+	}
+}
+
+func TestPerftDivide(t *testing.T) {
+	depth := 9
+	divide := PerftDivide(InitialState(), depth)
+	if len(divide) != 4 {
+		t.Fatalf("divide has %d moves, want 4", len(divide))
+	}
+	var total uint64
+	for move, nodes := range divide {
+		// The 4 opening moves are symmetric so they have the same count
+		if nodes != PerftResults[depth]/4 {
+			t.Errorf("divide of move %d = %d, want %d", move, nodes, PerftResults[depth]/4)
+		}
+		total += nodes
+	}
+	if total != PerftResults[depth] {
+		t.Errorf("sum of divide = %d, want %d", total, PerftResults[depth])
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// PONDER_MAX_NODES bounds the nodes that pondering adds to the trees (of all the routines of the parallel
+// searches), so that an opponent that takes a long time cannot fill the memory.
+const PONDER_MAX_NODES = 200000
+
+// Ponderer searches the position of an engine in the background while the opponent thinks.
+// The tree grown meanwhile is kept: when the opponent move arrives Engine.Play takes its subtree,
+// so the next search starts with the knowledge of the pondering.
+// Between Start and Stop the engine belongs to the pondering goroutine, the caller must not use it.
+type Ponderer struct {
+	engine   Engine
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+	playouts int
+}
+
+// NewPonderer returns a ponderer of the engine that is not pondering.
+func NewPonderer(engine Engine) *Ponderer {
+	return &Ponderer{engine: engine}
+}
+
+// Start starts pondering the current position of the engine, if it is not pondering already.
+// Positions that are over or that the solver plays (see ShouldSolve) are not pondered.
+func (p *Ponderer) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.engine.State()
+	if p.cancel != nil || IsTerminalState(state) || ShouldSolve(state) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p.cancel, p.done = cancel, done
+	go func() {
+		defer close(done)
+		_, stats := p.engine.BestMove(ctx, Limits{MaxNodes: PONDER_MAX_NODES})
+		p.playouts = stats.Playouts // Read by Stop after done is closed
+	}()
+}
+
+// Stop stops pondering and waits until the engine is free again.
+// Returns the playouts of the pondering (0 if it was not pondering).
+func (p *Ponderer) Stop() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel == nil {
+		return 0
+	}
+	p.cancel()
+	<-p.done
+	p.cancel, p.done = nil, nil
+	return p.playouts
+}
+
+// Pondering returns true between Start and Stop.
+func (p *Ponderer) Pondering() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cancel != nil
+}
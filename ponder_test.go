@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPonderKeepsTheSubtree(t *testing.T) {
+	engine := NewEngine("puct", rand.New(rand.NewSource(1)))
+	if err := engine.Play(19); err != nil { // d3, white thinks now
+		t.Fatal(err)
+	}
+	ponderer := NewPonderer(engine)
+	if playouts := ponderer.Stop(); playouts != 0 {
+		t.Errorf("Stop without Start = %d playouts", playouts)
+	}
+	ponderer.Start()
+	ponderer.Start() // Already pondering
+	time.Sleep(50 * time.Millisecond)
+	if !ponderer.Pondering() {
+		t.Error("not pondering after Start")
+	}
+	playouts := ponderer.Stop()
+	if playouts == 0 || ponderer.Pondering() {
+		t.Fatalf("pondered %d playouts, pondering %v", playouts, ponderer.Pondering())
+	}
+
+	root := engine.(*puctEngine).node
+	if root.Visits != playouts {
+		t.Errorf("root visits %d after %d playouts", root.Visits, playouts)
+	}
+	reply := BestNodeFromMCTSPUCT(root)
+	if err := engine.Play(reply.Move); err != nil {
+		t.Fatal(err)
+	}
+	if next := engine.(*puctEngine).node; next != reply || next.Visits == 0 {
+		t.Errorf("the pondered subtree of %s was not reused", MoveString(reply.Move))
+	}
+}
+
+func TestPonderSkipsFinishedGames(t *testing.T) {
+	engine := NewEngine("uct", rand.New(rand.NewSource(1)))
+	engine.Reset(randomGameRecord(rand.New(rand.NewSource(1))).State())
+	ponderer := NewPonderer(engine)
+	ponderer.Start()
+	if ponderer.Pondering() {
+		t.Error("pondering a finished game")
+	}
+}
+
+func TestGTPPonder(t *testing.T) {
+	var out strings.Builder
+	engine := NewGTPEngine(&out, rand.New(rand.NewSource(1)))
+	engine.Iterations = 50
+	engine.Ponder = true
+	engine.HandleCommand("genmove b")
+	if engine.ponderer == nil || !engine.ponderer.Pondering() {
+		t.Fatal("not pondering after genmove")
+	}
+	time.Sleep(20 * time.Millisecond)
+	state := engine.Engine.State()
+	reply := FastArrayOfMoves(legalMovesOf(state))[0]
+	engine.HandleCommand("play w " + MoveString(reply))
+	if engine.ponderer.Pondering() {
+		t.Error("still pondering after play")
+	}
+	if answer := out.String(); strings.Contains(answer, "?") {
+		t.Errorf("answers:\n%s", answer)
+	}
+}
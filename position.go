@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Position text format: the 64 squares from a1 to h8 (row by row) followed by the side to move,
+// as used by Edax, the FFO test suite and NBoard, for example the starting position is:
+//
+//	---------------------------OX------XO--------------------------- X
+//
+// Black is X and white is O. When parsing, '*' and 'B' are also black, '0' and 'W' are also white,
+// '.' and '_' are also empty, lowercase is accepted and spaces between squares are ignored.
+
+// ErrInvalidPosition is returned when a position string cannot be parsed.
+var ErrInvalidPosition = errors.New("invalid position")
+
+// PositionString returns the 64 characters of the board in the position text format.
+func (b *Board) PositionString() string {
+	var sb strings.Builder
+	sb.Grow(64)
+	for index := 0; index < 64; index++ {
+		mask := uint64(1) << index
+		switch {
+		case b.Black&mask != 0:
+			sb.WriteByte('X')
+		case b.White&mask != 0:
+			sb.WriteByte('O')
+		default:
+			sb.WriteByte('-')
+		}
+	}
+	return sb.String()
+}
+
+// PositionString returns the state in the position text format, board and side to move.
+func (s *State) PositionString() string {
+	if s.BlackTurn {
+		return s.Boards.PositionString() + " X"
+	}
+	return s.Boards.PositionString() + " O"
+}
+
+// ParsePosition returns the state described by a string in the position text format.
+// If the side to move has no moves but the opponent does, the turn is passed like the engine does after a move.
+func ParsePosition(text string) (State, error) {
+	var state State
+	index := 0
+	sideFound := false
+	for i, c := range text {
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			continue
+		}
+		if index < 64 {
+			mask := uint64(1) << index
+			switch c {
+			case 'X', 'x', '*', 'B', 'b':
+				state.Boards.Black |= mask
+			case 'O', 'o', '0', 'W', 'w':
+				state.Boards.White |= mask
+			case '-', '.', '_':
+			default:
+				return State{}, fmt.Errorf("%w: unexpected character %q at %d", ErrInvalidPosition, c, i)
+			}
+			index++
+			continue
+		}
+		if sideFound {
+			return State{}, fmt.Errorf("%w: unexpected character %q after the side to move", ErrInvalidPosition, c)
+		}
+		switch c {
+		case 'X', 'x', '*', 'B', 'b':
+			state.BlackTurn = true
+		case 'O', 'o', '0', 'W', 'w':
+			state.BlackTurn = false
+		default:
+			return State{}, fmt.Errorf("%w: unexpected side to move %q", ErrInvalidPosition, c)
+		}
+		sideFound = true
+	}
+	if index < 64 {
+		return State{}, fmt.Errorf("%w: %d squares, want 64", ErrInvalidPosition, index)
+	}
+	if !sideFound {
+		return State{}, fmt.Errorf("%w: missing side to move", ErrInvalidPosition)
+	}
+	if !state.Boards.HasValidMove(state.BlackTurn) && state.Boards.HasValidMove(!state.BlackTurn) {
+		state.BlackTurn = !state.BlackTurn
+	}
+	state.Hash = state.Boards.ZobristHash(state.BlackTurn)
+	return state, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestPositionStringRoundTrip(t *testing.T) {
+	initial := InitialState()
+	want := "---------------------------OX------XO--------------------------- X"
+	if got := initial.PositionString(); got != want {
+		t.Fatalf("PositionString() = %q, want %q", got, want)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		state := randomPositionWithEmpties(10+rng.Intn(50), rng)
+		state.Hash = state.Boards.ZobristHash(state.BlackTurn)
+		parsed, err := ParsePosition(state.PositionString())
+		if err != nil {
+			t.Fatalf("ParsePosition(%q): %v", state.PositionString(), err)
+		}
+		if parsed != state {
+			t.Fatalf("ParsePosition(%q) = %+v, want %+v", state.PositionString(), parsed, state)
+		}
+	}
+}
+
+func TestParsePositionErrors(t *testing.T) {
+	initial := InitialState()
+	valid := initial.PositionString()
+	invalid := []string{
+		"",
+		valid[:60] + " X", // Missing squares
+		valid[:64],        // Missing side to move
+		valid + "O",       // Two sides to move
+		"?" + valid[1:],   // Unknown square
+		valid[:65] + "Z",  // Unknown side to move
+	}
+	for _, text := range invalid {
+		if _, err := ParsePosition(text); !errors.Is(err, ErrInvalidPosition) {
+			t.Errorf("ParsePosition(%q) error = %v, want ErrInvalidPosition", text, err)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 // Node struct and methods for PUCT
 
 // PUCTNode is a game Node with extra variables needed to implement PUCT version of MCTS.
@@ -13,46 +18,51 @@ type PUCTNode struct {
 	GameState    State
 	Visits       int
 	Move         uint8
+	Table        *MCTSTable // Optional transposition table shared by the whole tree (nil to disable)
+	Proven       bool       // The result of the game from this node is known (see mctsSolver.go)
+	ProvenResult WinState   // The known result, only valid if Proven
+
+	// Used by the shared tree search (see TreeParallelizationMCTSPUCT)
+	mu          sync.Mutex   // Guards the children, the untried moves, the maps and Visits of this node
+	virtualLoss atomic.Int32 // Virtual lost playouts of the searches that are below this node
 }
 
 // InitialRootPUCTNode returns the initial root, the start of the game in Node PUCT form.
 func InitialRootPUCTNode() *PUCTNode {
-	var node *PUCTNode
-	var boards Board
-	boards.Init()
-	var state State
-	state.Boards = boards
-	state.BlackTurn = true
 	var emptyMove uint8
-	node = NewPUCTNode(state, nil, emptyMove)
-	return node
+	return NewPUCTNode(InitialState(), nil, emptyMove)
 }
 
 // NextPUCTNodeFromInput returns the root node of the subtree resulting
 // from selecting the given move from the current position.
+// It panics if the move is not valid, use TryNextPUCTNodeFromInput for moves that come from the user.
 func NextPUCTNodeFromInput(parent *PUCTNode, moveIndex uint8) *PUCTNode {
+	node, err := TryNextPUCTNodeFromInput(parent, moveIndex)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// TryNextPUCTNodeFromInput returns the root node of the subtree resulting from selecting the given move
+// from the current position, or an error if the move cannot be made (see State.TryMove).
+func TryNextPUCTNodeFromInput(parent *PUCTNode, moveIndex uint8) (*PUCTNode, error) {
 	// If the move exists in a subtree cut that subtree and preserve it, to preserve the information of previous simulations
 	for _, child := range parent.Children {
 		if child.Move == moveIndex {
 			child.Parent = nil
-			return child
+			return child, nil
 		}
 	}
-	newBoards := parent.GameState.Boards                           // Copy
-	newBoards.MakeMoveIndex(parent.GameState.BlackTurn, moveIndex) // We make the move on the current player
-	newState := State{
-		Boards:    newBoards,
-		BlackTurn: !parent.GameState.BlackTurn, // switch turn immediately
+	newState := parent.GameState // Copy
+	if err := newState.TryMove(newState.BlackTurn, moveIndex); err != nil {
+		return nil, err
 	}
-	// Switch turn but conditionally to deal with edgecase of the opponent having no moves.
-	if !newState.Boards.HasValidMove(newState.BlackTurn) && newState.Boards.HasValidMove(!newState.BlackTurn) {
-		//fmt.Println("No valid moves for next player — passing turn back.")
-		newState.BlackTurn = !newState.BlackTurn
-	}
-	return NewPUCTNode(newState, parent, moveIndex)
+	return NewPUCTNode(newState, parent, moveIndex), nil
 }
 
 // NewPUCTNode returns a new PUCT node.
+// The node shares the transposition table of its parent.
 func NewPUCTNode(state State, parent *PUCTNode, move uint8) *PUCTNode {
 	var legalMoves uint64
 	if state.BlackTurn {
@@ -60,7 +70,7 @@ func NewPUCTNode(state State, parent *PUCTNode, move uint8) *PUCTNode {
 	} else {
 		legalMoves = generateMoves(state.Boards.White, state.Boards.Black)
 	}
-	movesFromCurrent := FastArrayOfMoves(legalMoves)
+	movesFromCurrent := state.Boards.treeMoves(legalMoves) // Symmetric moves are the same game, keep one
 
 	priors := make(map[uint8]float64, len(movesFromCurrent))
 	uniformPrior := 1.0 / float64(len(movesFromCurrent))
@@ -68,6 +78,11 @@ func NewPUCTNode(state State, parent *PUCTNode, move uint8) *PUCTNode {
 		priors[m] = uniformPrior
 	}
 
+	var table *MCTSTable
+	if parent != nil {
+		table = parent.Table
+	}
+	result, proven := terminalProof(state, legalMoves)
 	return &PUCTNode{
 		Parent:       parent,
 		GameState:    state,
@@ -77,6 +92,9 @@ func NewPUCTNode(state State, parent *PUCTNode, move uint8) *PUCTNode {
 		N:            make(map[uint8]int),
 		Q:            make(map[uint8]float64),
 		P:            priors,
+		Table:        table,
+		Proven:       proven,
+		ProvenResult: result,
 	}
 }
 
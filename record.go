@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Game records keep what was played in a game (moves, passes, who played and how much they thought)
+// so games can be saved, loaded and replayed later.
+//
+// The text format has one "Key: value" per line and games are separated by an empty line:
+//
+//	Black: OriginalMonteCarloTreeSearch
+//	BlackConfig: 500 iterations
+//	BlackSeed: 1700000000000000000
+//	White: SingleRunParallelizationMCTSPUCT
+//	WhiteConfig: 200 iterations per routine
+//	WhiteSeed: 1700000000000000001
+//	Moves: f5d6c3d3c4f4
+//	Stats: 500/12ms 1800/3ms 500/11ms 1800/3ms 500/9ms 1800/2ms
+//	Score: 34-30
+//
+// Stats has the visits of the chosen move and the time used for every move in Moves (0/0s for passes).
+
+// ErrInvalidRecord is returned when a game record cannot be loaded or replayed.
+var ErrInvalidRecord = errors.New("invalid game record")
+
+// PlayerInfo describes who played one of the colors.
+type PlayerInfo struct {
+	Name   string // Engine (search function) or human
+	Config string // Parameters of the engine, like the number of iterations
+	Seed   int64  // Seed of the random number generator of the engine (0 if unknown)
+}
+
+// MoveStats are the thinking statistics of a move.
+type MoveStats struct {
+	Visits   int           // Visits of the chosen move after the search
+	Duration time.Duration // Time used to choose the move
+}
+
+// GameRecord is a game: the players, the moves (with passes as PASS_MOVE) and the final score.
+type GameRecord struct {
+	Black PlayerInfo
+	White PlayerInfo
+	Moves []uint8
+	Stats []MoveStats // One per move
+	Score [2]int      // Final score, position 0 is black, position 1 is white (see CurrentStateScore)
+
+	state State // Position after the moves, to validate the next ones
+}
+
+// NewGameRecord returns an empty record of a game that starts from the initial position.
+func NewGameRecord(black, white PlayerInfo) *GameRecord {
+	return &GameRecord{
+		Black: black,
+		White: white,
+		state: InitialState(),
+	}
+}
+
+// Play adds the move of the player in turn to the record, it panics if the move is not valid.
+// If the opponent has to pass after it, the pass is recorded too.
+func (r *GameRecord) Play(move uint8, stats MoveStats) {
+	if err := r.TryPlay(move, stats); err != nil {
+		panic(err)
+	}
+}
+
+// TryPlay is Play returning an error instead of panicking.
+func (r *GameRecord) TryPlay(move uint8, stats MoveStats) error {
+	record, err := r.state.MakeMove(move)
+	if err != nil {
+		return err
+	}
+	r.Moves = append(r.Moves, move)
+	r.Stats = append(r.Stats, stats)
+	if r.state.BlackTurn == record.BlackTurn && !IsTerminalState(r.state) {
+		r.Moves = append(r.Moves, PASS_MOVE)
+		r.Stats = append(r.Stats, MoveStats{})
+	}
+	r.Score = CurrentStateScore(r.state)
+	return nil
+}
+
+// State returns the position after the moves of the record.
+func (r *GameRecord) State() State {
+	return r.state
+}
+
+// ReplayGame plays the moves from the initial position validating every one of them with IsValidMoveIndex.
+// Passes can be given explicitly (PASS_MOVE, only when the player has no moves) or be left out.
+// Returns the states after every move (without the passes).
+func ReplayGame(moves []uint8) ([]State, error) {
+	state := InitialState()
+	states := make([]State, 0, len(moves))
+	passPending := false // The opponent of the last move had to pass
+	for i, move := range moves {
+		if move == PASS_MOVE {
+			if !passPending {
+				return nil, fmt.Errorf("%w: move %d is a pass but the player has moves", ErrInvalidRecord, i+1)
+			}
+			passPending = false
+			continue
+		}
+		if IsTerminalState(state) {
+			return nil, fmt.Errorf("%w: move %d %s after the end of the game", ErrInvalidRecord, i+1, MoveString(move))
+		}
+		if !state.Boards.IsValidMoveIndex(state.BlackTurn, move) {
+			return nil, fmt.Errorf("%w: move %d %s is not valid", ErrInvalidRecord, i+1, MoveString(move))
+		}
+		blackTurn := state.BlackTurn
+		state.ApplyMove(move)
+		passPending = state.BlackTurn == blackTurn && !IsTerminalState(state)
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Replay validates the moves of the record (see ReplayGame) and checks the recorded score.
+// Returns the states after every move.
+func (r *GameRecord) Replay() ([]State, error) {
+	states, err := ReplayGame(r.Moves)
+	if err != nil {
+		return nil, err
+	}
+	final := InitialState()
+	if len(states) > 0 {
+		final = states[len(states)-1]
+	}
+	if IsTerminalState(final) && CurrentStateScore(final) != r.Score {
+		return nil, fmt.Errorf("%w: recorded score %d-%d but the game ends %d-%d", ErrInvalidRecord,
+			r.Score[0], r.Score[1], CurrentStateScore(final)[0], CurrentStateScore(final)[1])
+	}
+	return states, nil
+}
+
+// WriteTo writes the record in the text format.
+func (r *GameRecord) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	for _, player := range []struct {
+		color string
+		info  PlayerInfo
+	}{{"Black", r.Black}, {"White", r.White}} {
+		fmt.Fprintf(&sb, "%s: %s\n", player.color, player.info.Name)
+		fmt.Fprintf(&sb, "%sConfig: %s\n", player.color, player.info.Config)
+		fmt.Fprintf(&sb, "%sSeed: %d\n", player.color, player.info.Seed)
+	}
+	fmt.Fprintf(&sb, "Moves: %s\n", MovesString(r.Moves))
+	stats := make([]string, len(r.Stats))
+	for i, s := range r.Stats {
+		stats[i] = fmt.Sprintf("%d/%s", s.Visits, s.Duration)
+	}
+	fmt.Fprintf(&sb, "Stats: %s\n", strings.Join(stats, " "))
+	fmt.Fprintf(&sb, "Score: %d-%d\n", r.Score[0], r.Score[1])
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// SaveGameRecords writes the records to a file, separated by an empty line.
+func SaveGameRecords(path string, records []*GameRecord) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for i, record := range records {
+		if i > 0 {
+			writer.WriteString("\n")
+		}
+		if _, err := record.WriteTo(writer); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadGameRecords reads the records of a file written by SaveGameRecords.
+func LoadGameRecords(path string) ([]*GameRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadGameRecords(file)
+}
+
+// ReadGameRecords reads records in the text format. Every record is replayed to validate it.
+func ReadGameRecords(r io.Reader) ([]*GameRecord, error) {
+	var records []*GameRecord
+	var current *GameRecord
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		states, err := current.Replay()
+		if err != nil {
+			return err
+		}
+		current.state = InitialState()
+		if len(states) > 0 {
+			current.state = states[len(states)-1]
+		}
+		records = append(records, current)
+		current = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue // Comment
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("%w: line %d has no key", ErrInvalidRecord, lineNumber)
+		}
+		if current == nil {
+			current = &GameRecord{}
+		}
+		if err := current.setField(key, strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidRecord, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// setField sets the field of the record of one line of the text format.
+func (r *GameRecord) setField(key, value string) error {
+	var err error
+	switch key {
+	case "Black":
+		r.Black.Name = value
+	case "BlackConfig":
+		r.Black.Config = value
+	case "BlackSeed":
+		r.Black.Seed, err = strconv.ParseInt(value, 10, 64)
+	case "White":
+		r.White.Name = value
+	case "WhiteConfig":
+		r.White.Config = value
+	case "WhiteSeed":
+		r.White.Seed, err = strconv.ParseInt(value, 10, 64)
+	case "Moves":
+		r.Moves, err = ParseMoves(value)
+	case "Stats":
+		r.Stats, err = parseMoveStats(value)
+	case "Score":
+		_, err = fmt.Sscanf(value, "%d-%d", &r.Score[0], &r.Score[1])
+	default:
+		err = fmt.Errorf("unknown key %q", key)
+	}
+	return err
+}
+
+// parseMoveStats parses the Stats line, "visits/duration" separated by spaces.
+func parseMoveStats(value string) ([]MoveStats, error) {
+	fields := strings.Fields(value)
+	stats := make([]MoveStats, len(fields))
+	for i, field := range fields {
+		visits, duration, found := strings.Cut(field, "/")
+		if !found {
+			return nil, fmt.Errorf("stats %q are not visits/duration", field)
+		}
+		var err error
+		if stats[i].Visits, err = strconv.Atoi(visits); err != nil {
+			return nil, err
+		}
+		if stats[i].Duration, err = time.ParseDuration(duration); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// randomGameRecord plays a random game until the end.
+func randomGameRecord(rng *rand.Rand) *GameRecord {
+	record := NewGameRecord(PlayerInfo{Name: "random", Seed: 1}, PlayerInfo{Name: "random", Config: "uniform", Seed: 2})
+	for state := record.State(); !IsTerminalState(state); state = record.State() {
+		moves := FastArrayOfMoves(legalMovesOf(state))
+		record.Play(moves[rng.Intn(len(moves))], MoveStats{Visits: rng.Intn(1000), Duration: time.Duration(rng.Intn(1000)) * time.Millisecond})
+	}
+	return record
+}
+
+func TestGameRecordRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	records := make([]*GameRecord, 20)
+	for i := range records {
+		records[i] = randomGameRecord(rng)
+	}
+	var buf bytes.Buffer
+	for i, record := range records {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		if _, err := record.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaded, err := ReadGameRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(records) {
+		t.Fatalf("loaded %d records, want %d", len(loaded), len(records))
+	}
+	for i := range records {
+		if !reflect.DeepEqual(loaded[i], records[i]) {
+			t.Errorf("record %d changed after saving and loading:\n%+v\n%+v", i, loaded[i], records[i])
+		}
+	}
+}
+
+func TestReplayGame(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	var withPass *GameRecord
+	for i := 0; i < 1000 && withPass == nil; i++ {
+		record := randomGameRecord(rng)
+		for _, move := range record.Moves {
+			if move == PASS_MOVE {
+				withPass = record
+			}
+		}
+	}
+	if withPass == nil {
+		t.Fatal("no random game with a pass")
+	}
+	states, err := withPass.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, want := states[len(states)-1], withPass.State()
+	if final != want {
+		t.Errorf("replay ends in %s, want %s", final.PositionString(), want.PositionString())
+	}
+
+	// The passes can be left out
+	var withoutPasses []uint8
+	for _, move := range withPass.Moves {
+		if move != PASS_MOVE {
+			withoutPasses = append(withoutPasses, move)
+		}
+	}
+	if _, err := ReplayGame(withoutPasses); err != nil {
+		t.Errorf("replay without passes: %v", err)
+	}
+
+	for _, transcript := range []string{"f5f5", "f5PS", "a1"} {
+		moves, _ := ParseMoves(transcript)
+		if _, err := ReplayGame(moves); !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("ReplayGame(%s) error = %v, want ErrInvalidRecord", transcript, err)
+		}
+	}
+	wrongScore := *withPass
+	wrongScore.Score[0]++
+	if _, err := wrongScore.Replay(); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("Replay with a wrong score error = %v, want ErrInvalidRecord", err)
+	}
+	if err := withPass.TryPlay(19, MoveStats{}); err == nil {
+		t.Error("TryPlay after the end of the game did not fail")
+	}
+}
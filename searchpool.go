@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// SearchWorkers is the number of worker routines of the root parallel searches.
+// 0 uses the SEARCH_WORKERS_ENV environment variable if it is set, or runtime.GOMAXPROCS otherwise.
+var SearchWorkers = 0
+
+// SEARCH_WORKERS_ENV is the environment variable with the number of workers, see SearchWorkers.
+const SEARCH_WORKERS_ENV = "OTHELLO_WORKERS"
+
+// SearchPool holds the workers of the root parallel searches between moves.
+// Every worker keeps its routine, its rng and its copy of the root: the routine waits for the next search
+// between moves, and when that search starts from a position of the worker tree (the previous root,
+// or one or two moves after it) the subtree is reused. So the workers do not start from scratch and
+// no routine or rand.Source is made for every move. The routines stop when the pool is collected.
+// A pool runs one search at a time, the others wait for it.
+type SearchPool struct {
+	mu      sync.Mutex
+	workers []poolWorker
+}
+
+// poolWorker is a worker of a SearchPool, only one of its roots is used depending on the search.
+type poolWorker struct {
+	rng      *rand.Rand
+	root     *Node
+	rootPUCT *PUCTNode
+	jobs     chan func(worker *poolWorker) // The searches of the worker, run by its routine
+}
+
+// run runs the searches of the worker until its jobs are closed.
+func (worker *poolWorker) run() {
+	for job := range worker.jobs {
+		job(worker)
+	}
+}
+
+// NewSearchPool returns a pool of workers (SearchWorkers if workers <= 0) with rngs split from a seed of baseRNG.
+func NewSearchPool(workers int, baseRNG *rand.Rand) *SearchPool {
+	if workers <= 0 {
+		workers = searchWorkers()
+	}
+	pool := &SearchPool{workers: make([]poolWorker, workers)}
+	seed := baseRNG.Int63()
+	for i := range pool.workers {
+		worker := &pool.workers[i]
+		worker.rng = NewStreamRNG(seed, i)
+		worker.jobs = make(chan func(worker *poolWorker))
+		go worker.run() // The routine only refers to the worker, not to the pool
+	}
+	runtime.AddCleanup(pool, func(workers []poolWorker) {
+		for i := range workers {
+			close(workers[i].jobs)
+		}
+	}, pool.workers)
+	return pool
+}
+
+// defaultSearchPool is the pool of the package level root parallel searches, made on the first search.
+var defaultSearchPool = sync.OnceValue(func() *SearchPool {
+	return NewSearchPool(0, rand.New(rand.NewSource(NewSeed())))
+})
+
+// searchWorkers returns the number of workers of a pool, see SearchWorkers.
+func searchWorkers() int {
+	if SearchWorkers > 0 {
+		return SearchWorkers
+	}
+	if workers, err := strconv.Atoi(os.Getenv(SEARCH_WORKERS_ENV)); err == nil && workers > 0 {
+		return workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// Workers returns the number of workers of the pool.
+func (pool *SearchPool) Workers() int {
+	return len(pool.workers)
+}
+
+// reuseRoot returns the node of the tree of root at the state, up to two moves deep, or a new root for it.
+// The returned node is detached from its parent, so the rest of the old tree can be collected.
+func reuseRoot(root *Node, state State) *Node {
+	if root != nil {
+		if root.GameState == state {
+			return root
+		}
+		for _, child := range root.Children {
+			if child.GameState == state {
+				child.Parent = nil
+				return child
+			}
+			for _, grandchild := range child.Children {
+				if grandchild.GameState == state {
+					grandchild.Parent = nil
+					return grandchild
+				}
+			}
+		}
+	}
+	return NewNode(state, nil, PASS_MOVE)
+}
+
+// reuseRootPUCT is reuseRoot for PUCTNode trees.
+func reuseRootPUCT(root *PUCTNode, state State) *PUCTNode {
+	if root != nil {
+		if root.GameState == state {
+			return root
+		}
+		for _, child := range root.Children {
+			if child.GameState == state {
+				child.Parent = nil
+				return child
+			}
+			for _, grandchild := range child.Children {
+				if grandchild.GameState == state {
+					grandchild.Parent = nil
+					return grandchild
+				}
+			}
+		}
+	}
+	return NewPUCTNode(state, nil, PASS_MOVE)
+}
+
+// rootResult returns the visits and the wins of the children of the root by move.
+func rootResult(root *Node) parallelResult {
+	res := parallelResult{visits: make(map[uint8]int, len(root.Children)), wins: make(map[uint8]float64, len(root.Children))}
+	for _, child := range root.Children {
+		res.visits[child.Move] = child.Visits
+		res.wins[child.Move] = float64(child.Wins)
+	}
+	return res
+}
+
+// rootResultPUCT is rootResult for PUCTNode trees, the wins are the sum of the rewards.
+func rootResultPUCT(root *PUCTNode) parallelResult {
+	res := parallelResult{visits: maps.Clone(root.N), wins: make(map[uint8]float64, len(root.N))}
+	for move, visits := range root.N {
+		res.wins[move] = root.Q[move] * float64(visits)
+	}
+	return res
+}
+
+// newResult returns the visits and wins by move of after that are not in before.
+// A reused worker tree already has visits, only the ones of the current search are merged into the master tree.
+func newResult(before, after parallelResult) parallelResult {
+	res := parallelResult{visits: make(map[uint8]int, len(after.visits)), wins: make(map[uint8]float64, len(after.wins))}
+	for move, visits := range after.visits {
+		res.visits[move] = visits - before.visits[move]
+		res.wins[move] = after.wins[move] - before.wins[move]
+	}
+	return res
+}
+
+// mergeResult adds the visits and wins of a worker to the root children of the master tree.
+// The root gets the visits too, so its children never have more visits than it has.
+func mergeResult(root *Node, res parallelResult) {
+	for _, child := range root.Children {
+		child.Visits += res.visits[child.Move]
+		child.Wins += int(res.wins[child.Move])
+		root.Visits += res.visits[child.Move]
+	}
+}
+
+// mergeResultPUCT is mergeResult for PUCTNode trees, the Q of every move stays the average of its rewards.
+func mergeResultPUCT(root *PUCTNode, res parallelResult) {
+	for _, child := range root.Children {
+		move := child.Move
+		visits := res.visits[move]
+		if visits == 0 {
+			continue
+		}
+		rewards := root.Q[move]*float64(root.N[move]) + res.wins[move]
+		root.N[move] += visits
+		root.Q[move] = rewards / float64(root.N[move])
+		child.Visits += visits
+		root.Visits += visits
+	}
+}
+
+// SingleRunParallelizationMCTS is SingleRunParallelizationMCTS with the workers of the pool.
+func (pool *SearchPool) SingleRunParallelizationMCTS(currentRoot *Node, iterationsPerRoutine int, baseRNG *rand.Rand) *Node {
+	best, _ := pool.SingleRunParallelizationMCTSContext(context.Background(), currentRoot, Limits{Iterations: iterationsPerRoutine}, baseRNG)
+	return best
+}
+
+// SingleRunParallelizationMCTSContext is SingleRunParallelizationMCTSContext with the workers of the pool.
+// baseRNG is the rng of the master search.
+func (pool *SearchPool) SingleRunParallelizationMCTSContext(ctx context.Context, currentRoot *Node, limits Limits, baseRNG *rand.Rand) (*Node, int) {
+	if currentRoot.IsTerminal() {
+		return currentRoot, 0
+	}
+	if limits.solves(currentRoot.GameState) {
+		if best := solvedBestNodeWithin(ctx, currentRoot, limits); best != nil {
+			return best, 0
+		}
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	routineLimits := limits.perRoutine(len(pool.workers) + 1) // The master is a routine too
+	firstLayerRes := make(chan parallelResult, len(pool.workers))
+	for i := range pool.workers {
+		pool.workers[i].jobs <- func(worker *poolWorker) {
+			// The workers never share the master root, that would be a race condition
+			worker.root = reuseRoot(worker.root, currentRoot.GameState)
+			before := rootResult(worker.root)
+			playouts := searchOriginalMCTS(ctx, worker.root, routineLimits, worker.rng)
+			res := newResult(before, rootResult(worker.root))
+			res.playouts = playouts
+			firstLayerRes <- res
+		}
+	}
+	playouts := searchOriginalMCTS(ctx, currentRoot, routineLimits, baseRNG) // The master runs meanwhile
+	for range pool.workers {
+		res := <-firstLayerRes
+		playouts += res.playouts
+		mergeResult(currentRoot, res)
+	}
+	return BestNodeFromMCTS(currentRoot), playouts
+}
+
+// SingleRunParallelizationMCTSPUCT is SingleRunParallelizationMCTSPUCT with the workers of the pool.
+func (pool *SearchPool) SingleRunParallelizationMCTSPUCT(currentRoot *PUCTNode, iterationsPerRoutine int, baseRNG *rand.Rand) *PUCTNode {
+	best, _ := pool.SingleRunParallelizationMCTSPUCTContext(context.Background(), currentRoot, Limits{Iterations: iterationsPerRoutine}, baseRNG)
+	return best
+}
+
+// SingleRunParallelizationMCTSPUCTContext is SingleRunParallelizationMCTSPUCTContext with the workers of the pool.
+// baseRNG is the rng of the master search.
+func (pool *SearchPool) SingleRunParallelizationMCTSPUCTContext(ctx context.Context, currentRoot *PUCTNode, limits Limits, baseRNG *rand.Rand) (*PUCTNode, int) {
+	if currentRoot.IsTerminalPUCT() {
+		return currentRoot, 0
+	}
+	if limits.solves(currentRoot.GameState) {
+		if best := solvedBestNodePUCTWithin(ctx, currentRoot, limits); best != nil {
+			return best, 0
+		}
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	routineLimits := limits.perRoutine(len(pool.workers) + 1) // The master is a routine too
+	firstLayerRes := make(chan parallelResult, len(pool.workers))
+	for i := range pool.workers {
+		pool.workers[i].jobs <- func(worker *poolWorker) {
+			// The workers never share the master root, that would be a race condition
+			worker.rootPUCT = reuseRootPUCT(worker.rootPUCT, currentRoot.GameState)
+			before := rootResultPUCT(worker.rootPUCT)
+			playouts := searchMCTSPUCT(ctx, worker.rootPUCT, routineLimits, worker.rng)
+			res := newResult(before, rootResultPUCT(worker.rootPUCT))
+			res.playouts = playouts
+			firstLayerRes <- res
+		}
+	}
+	playouts := searchMCTSPUCT(ctx, currentRoot, routineLimits, baseRNG) // The master runs meanwhile
+	for range pool.workers {
+		res := <-firstLayerRes
+		playouts += res.playouts
+		mergeResultPUCT(currentRoot, res)
+	}
+	return BestNodeFromMCTSPUCT(currentRoot), playouts
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSearchPoolWorkers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	if workers := NewSearchPool(3, rng).Workers(); workers != 3 {
+		t.Errorf("pool of 3 has %d workers", workers)
+	}
+	defer func(workers int) { SearchWorkers = workers }(SearchWorkers)
+	SearchWorkers = 2
+	if workers := NewSearchPool(0, rng).Workers(); workers != 2 {
+		t.Errorf("pool with SearchWorkers 2 has %d workers", workers)
+	}
+	t.Setenv(SEARCH_WORKERS_ENV, "5")
+	SearchWorkers = 0
+	if workers := NewSearchPool(0, rng).Workers(); workers != 5 {
+		t.Errorf("pool with %s=5 has %d workers", SEARCH_WORKERS_ENV, workers)
+	}
+}
+
+func TestSearchPoolReusesWorkerTrees(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pool := NewSearchPool(2, rng)
+	root := InitialRootPUCTNode()
+	root.GameState.ApplyMove(19) // d3, white has several unique moves
+	root = NewPUCTNode(root.GameState, nil, PASS_MOVE)
+
+	// Searching the same root twice merges only the new visits of the workers
+	total := 0
+	for i := 0; i < 2; i++ {
+		_, playouts := pool.SingleRunParallelizationMCTSPUCTContext(context.Background(), root, Limits{Iterations: 100}, rng)
+		total += playouts
+	}
+	visits := 0
+	for _, child := range root.Children {
+		visits += child.Visits
+	}
+	if visits != total || root.Visits != total {
+		t.Errorf("root children have %d visits and the root %d after %d playouts", visits, root.Visits, total)
+	}
+
+	// After the move the worker keeps searching its subtree
+	reply := BestNodeFromMCTSPUCT(root)
+	if reused := reuseRootPUCT(pool.workers[0].rootPUCT, reply.GameState); reused.Visits == 0 || reused.Parent != nil {
+		t.Errorf("the subtree of %s was not reused (visits %d)", MoveString(reply.Move), reused.Visits)
+	}
+}
+
+func TestSearchPoolMergesWins(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pool := NewSearchPool(3, rng)
+	root := InitialRootNode()
+	root.GameState.ApplyMove(19) // d3, white has several unique moves
+	root = NewNode(root.GameState, nil, PASS_MOVE)
+	pool.SingleRunParallelizationMCTSContext(context.Background(), root, Limits{Iterations: 400}, rng)
+	visits := 0
+	for _, child := range root.Children {
+		visits += child.Visits
+		// The workers add their wins with their visits, the win rate is not divided by the routines
+		if rate := float64(child.Wins) / float64(child.Visits); child.Visits > 100 && (rate < 0.2 || rate > 0.8) {
+			t.Errorf("child %s wins %d of %d visits", MoveString(child.Move), child.Wins, child.Visits)
+		}
+	}
+	if visits > root.Visits {
+		t.Errorf("root children have %d visits, the root %d", visits, root.Visits)
+	}
+
+	rootPUCT := NewPUCTNode(root.GameState, nil, PASS_MOVE)
+	pool.SingleRunParallelizationMCTSPUCTContext(context.Background(), rootPUCT, Limits{Iterations: 400}, rng)
+	for _, child := range rootPUCT.Children {
+		if child.Visits != rootPUCT.N[child.Move] || rootPUCT.Q[child.Move] < 0 || rootPUCT.Q[child.Move] > 1 {
+			t.Errorf("child %s has %d visits, the root counts %d with Q %v", MoveString(child.Move), child.Visits, rootPUCT.N[child.Move], rootPUCT.Q[child.Move])
+		}
+	}
+}
+
+func TestDefaultSearchPool(t *testing.T) {
+	// The package level searches share a pool, so the workers keep their trees between the calls
+	root := InitialRootPUCTNode()
+	SingleRunParallelizationMCTSPUCT(root, 20, rand.New(rand.NewSource(1)))
+	pool := defaultSearchPool()
+	if pool != defaultSearchPool() {
+		t.Fatal("the package level searches do not share their pool")
+	}
+	if worker := pool.workers[0].rootPUCT; worker == nil || worker.GameState != root.GameState || worker.Visits == 0 {
+		t.Error("the worker tree of the package level search was not kept")
+	}
+
+	// One search at a time
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			SingleRunParallelizationMCTSPUCT(InitialRootPUCTNode(), 20, rand.New(rand.NewSource(int64(i))))
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Seeds of the random number generators. A run is reproducible from a single seed: every rng of the
+// program (the engines, the sessions of the servers and the workers of the parallel searches) is a stream
+// split from it, so the streams do not depend on the order in which the routines are started.
+// A search is only reproducible when it is limited by iterations or nodes, a deadline or a cancelled
+// context stops it at a different playout every time.
+
+// SEED_ENV is the environment variable with the seed of the program, see NewSeed.
+const SEED_ENV = "OTHELLO_SEED"
+
+// DeterministicSearch makes the shared tree search (TreeParallelizationMCTSPUCT) reproducible:
+// its workers take turns in a single routine instead of running at the same time.
+// The other searches are reproducible anyway. It is set when the seed is given with SEED_ENV.
+// The parallel searches are only reproducible with the same number of workers: by default it is the number
+// of processors (runtime.GOMAXPROCS), so set SearchWorkers or SEARCH_WORKERS_ENV to get the same
+// moves from a seed on different machines.
+var DeterministicSearch = false
+
+// NewSeed returns the seed of SEED_ENV if it is set, otherwise a seed from the clock.
+func NewSeed() int64 {
+	if seed, found := seedFromEnv(); found {
+		return seed
+	}
+	return time.Now().UnixNano()
+}
+
+// seedFromEnv returns the seed of SEED_ENV, found is false if it is not set or not a number.
+func seedFromEnv() (seed int64, found bool) {
+	seed, err := strconv.ParseInt(os.Getenv(SEED_ENV), 10, 64)
+	return seed, err == nil
+}
+
+// SplitSeed returns the seed of the stream of seed. Different streams of a seed give unrelated sequences,
+// even for consecutive seeds (unlike seed+stream).
+func SplitSeed(seed int64, stream int) int64 {
+	// SplitMix64 of the stream position
+	z := uint64(seed) + (uint64(stream)+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// NewStreamRNG returns the rng of the stream of seed, see SplitSeed.
+func NewStreamRNG(seed int64, stream int) *rand.Rand {
+	return rand.New(rand.NewSource(SplitSeed(seed, stream)))
+}
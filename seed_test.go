@@ -0,0 +1,42 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitSeed(t *testing.T) {
+	if NewStreamRNG(1, 0).Int63() != NewStreamRNG(1, 0).Int63() {
+		t.Error("the same stream gave different numbers")
+	}
+	seen := make(map[int64]bool)
+	for seed := int64(0); seed < 4; seed++ {
+		for stream := 0; stream < 4; stream++ {
+			split := SplitSeed(seed, stream)
+			if seen[split] {
+				t.Errorf("SplitSeed(%d, %d) = %d was already used", seed, stream, split)
+			}
+			seen[split] = true
+		}
+	}
+}
+
+func TestSearchesAreReproducible(t *testing.T) {
+	defer func(empties, workers int, deterministic bool) {
+		EndgameEmpties, SearchWorkers, DeterministicSearch = empties, workers, deterministic
+	}(EndgameEmpties, SearchWorkers, DeterministicSearch)
+	EndgameEmpties = 10 // Faster games
+	SearchWorkers = 3   // Several workers even on one processor
+	DeterministicSearch = true
+	for _, name := range EngineNames() {
+		var games [2][]uint8
+		for i := range games {
+			black, white := NewEngine(name, NewStreamRNG(1, 0)), NewEngine(name, NewStreamRNG(1, 1))
+			limits := Limits{Iterations: 30}
+			games[i] = PlayEngines(black, white, [2]Limits{limits, limits}, [2]PlayerInfo{}).Moves
+		}
+		if !slices.Equal(games[0], games[1]) {
+			t.Errorf("%s played different games with the same seed:\n%v\n%v", name, games[0], games[1])
+		}
+	}
+}
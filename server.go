@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Local HTTP/JSON analysis server. Positions are in the position text format (see position.go)
+// and moves in standard notation (see notation.go). The endpoints are:
+//
+//	POST   /moves                   {"position"}                         legal moves of the position
+//	POST   /move                    {"position", "move"}                 position after the move
+//	POST   /analyze                 {"position", "iterations", "millis"} search and statistics of every move
+//	POST   /sessions                                                     new game, its tree is kept between calls
+//	GET    /sessions/{id}                                                current position of the game
+//	POST   /sessions/{id}/move      {"move"}                             play a move in the game
+//	POST   /sessions/{id}/analyze   {"iterations", "millis"}             search the current position of the game
+//	DELETE /sessions/{id}                                                end the game
+//
+// The search runs until the iterations or the milliseconds are reached (whichever comes first,
+// 1000 iterations if none is given). Close to the end of the game every move is solved exactly instead,
+// when the solves fit in half of the milliseconds (of SERVER_MAX_MILLIS if none are given).
+// At most SERVER_MAX_SESSIONS games are kept, a new one ends the game that was used least recently.
+// Errors are answered with {"error"} and status 400 (bad request) or 404 (unknown session).
+
+// Limits of the server so that one request cannot keep it busy forever.
+const (
+	SERVER_DEFAULT_ITERATIONS = 1000
+	SERVER_MAX_ITERATIONS     = 1000000
+	SERVER_MAX_MILLIS         = 60000
+	SERVER_MAX_SESSIONS       = 256
+)
+
+// AnalysisServer answers the analysis requests and keeps the game sessions.
+type AnalysisServer struct {
+	MaxSessions int // Games kept, the least recently used one ends when a new one starts beyond this
+	mu          sync.Mutex
+	sessions    map[string]*analysisSession
+	nextID      int
+}
+
+// analysisSession is a game of the server. The mutex serializes the requests of the game.
+type analysisSession struct {
+	mu       sync.Mutex
+	node     *PUCTNode
+	moves    []uint8
+	rng      *rand.Rand
+	lastUsed time.Time // Guarded by the mutex of the server
+}
+
+// PositionResponse describes a position.
+type PositionResponse struct {
+	Session   string   `json:"session,omitempty"`
+	Position  string   `json:"position"`
+	BlackTurn bool     `json:"blackTurn"`
+	Moves     []string `json:"moves"` // Legal moves of the side to move
+	GameOver  bool     `json:"gameOver"`
+	Score     [2]int   `json:"score"` // Discs of black and white
+	History   string   `json:"history,omitempty"`
+}
+
+// MoveAnalysis is the statistics of a move after a search.
+// The search only keeps one of the moves that are symmetric (see SymmetricMoves), the others get its statistics.
+type MoveAnalysis struct {
+	Move   string  `json:"move"`
+	Visits int     `json:"visits"`
+	Q      float64 `json:"q"` // Win rate for the side to move
+	Prior  float64 `json:"prior"`
+	Score  *int    `json:"score,omitempty"` // Exact final disc differential, when solved
+}
+
+// AnalysisResponse is the result of a search, the moves from best to worst.
+type AnalysisResponse struct {
+	PositionResponse
+	Iterations int            `json:"iterations"`
+	Millis     int64          `json:"millis"`
+	Solved     bool           `json:"solved"`
+	Best       string         `json:"best,omitempty"`
+	Analysis   []MoveAnalysis `json:"analysis"`
+}
+
+// analysisRequest is the body of the requests, every endpoint uses some of the fields.
+type analysisRequest struct {
+	Position   string `json:"position"`
+	Move       string `json:"move"`
+	Iterations int    `json:"iterations"`
+	Millis     int64  `json:"millis"`
+}
+
+// NewAnalysisServer returns a server without sessions.
+func NewAnalysisServer() *AnalysisServer {
+	return &AnalysisServer{MaxSessions: SERVER_MAX_SESSIONS, sessions: make(map[string]*analysisSession)}
+}
+
+// Handler returns the HTTP handler of the endpoints.
+func (s *AnalysisServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /moves", s.handleMoves)
+	mux.HandleFunc("POST /move", s.handleMove)
+	mux.HandleFunc("POST /analyze", s.handleAnalyze)
+	mux.HandleFunc("POST /sessions", s.handleNewSession)
+	mux.HandleFunc("GET /sessions/{id}", s.handleGetSession)
+	mux.HandleFunc("POST /sessions/{id}/move", s.handleSessionMove)
+	mux.HandleFunc("POST /sessions/{id}/analyze", s.handleSessionAnalyze)
+	mux.HandleFunc("DELETE /sessions/{id}", s.handleDeleteSession)
+	return mux
+}
+
+// writeJSON answers with the value in JSON.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError answers with the error in JSON.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// readRequest decodes the JSON body of the request (an empty body is an empty request).
+func readRequest(r *http.Request) (analysisRequest, error) {
+	var request analysisRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		return request, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return request, nil
+}
+
+// positionResponse describes the state.
+func positionResponse(state State) PositionResponse {
+	response := PositionResponse{
+		Position:  state.PositionString(),
+		BlackTurn: state.BlackTurn,
+		Moves:     []string{},
+		GameOver:  IsTerminalState(state),
+		Score:     CurrentStateScore(state),
+	}
+	for _, move := range FastArrayOfMoves(legalMovesOf(state)) {
+		response.Moves = append(response.Moves, MoveString(move))
+	}
+	return response
+}
+
+// handleMoves answers the legal moves of a position.
+func (s *AnalysisServer) handleMoves(w http.ResponseWriter, r *http.Request) {
+	request, err := readRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	state, err := ParsePosition(request.Position)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, positionResponse(state))
+}
+
+// handleMove answers the position after a move.
+func (s *AnalysisServer) handleMove(w http.ResponseWriter, r *http.Request) {
+	request, err := readRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	state, err := ParsePosition(request.Position)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	move, err := ParseMove(request.Move)
+	if err == nil {
+		err = state.TryMove(state.BlackTurn, move)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, positionResponse(state))
+}
+
+// handleAnalyze searches a position with a new tree.
+func (s *AnalysisServer) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	request, err := readRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	state, err := ParsePosition(request.Position)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var emptyMove uint8
+	root := NewPUCTNode(state, nil, emptyMove)
+	rng := rand.New(rand.NewSource(NewSeed()))
+	response, err := analyzePUCT(r.Context(), root, request.Iterations, request.Millis, rng)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleNewSession starts a game from the initial position.
+func (s *AnalysisServer) handleNewSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	session := &analysisSession{
+		node:     InitialRootPUCTNode(),
+		rng:      NewStreamRNG(NewSeed(), s.nextID),
+		lastUsed: time.Now(),
+	}
+	if len(s.sessions) >= s.MaxSessions {
+		s.evictSession()
+	}
+	s.sessions[id] = session
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, session.response(id))
+}
+
+// evictSession ends the session that was used least recently, the mutex must be held.
+// A request of the session that is running meanwhile finishes normally.
+func (s *AnalysisServer) evictSession() {
+	oldest := ""
+	for id, session := range s.sessions {
+		if oldest == "" || session.lastUsed.Before(s.sessions[oldest].lastUsed) {
+			oldest = id
+		}
+	}
+	delete(s.sessions, oldest)
+}
+
+// session returns the session of the request, or answers 404.
+func (s *AnalysisServer) session(w http.ResponseWriter, r *http.Request) (string, *analysisSession) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	session := s.sessions[id]
+	if session != nil {
+		session.lastUsed = time.Now()
+	}
+	s.mu.Unlock()
+	if session == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown session %q", id))
+	}
+	return id, session
+}
+
+// response describes the current position of the session, the mutex must be held.
+func (session *analysisSession) response(id string) PositionResponse {
+	response := positionResponse(session.node.GameState)
+	response.Session = id
+	response.History = MovesString(session.moves)
+	return response
+}
+
+// handleGetSession answers the current position of a game.
+func (s *AnalysisServer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	id, session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	writeJSON(w, http.StatusOK, session.response(id))
+}
+
+// handleSessionMove plays a move in a game, keeping the subtree of the move.
+func (s *AnalysisServer) handleSessionMove(w http.ResponseWriter, r *http.Request) {
+	id, session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	request, err := readRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	move, err := ParseMove(request.Move)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	next, err := TryNextPUCTNodeFromInput(session.node, move)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	session.node = next
+	session.moves = append(session.moves, move)
+	writeJSON(w, http.StatusOK, session.response(id))
+}
+
+// handleSessionAnalyze searches the current position of a game, adding to the statistics of previous calls.
+func (s *AnalysisServer) handleSessionAnalyze(w http.ResponseWriter, r *http.Request) {
+	id, session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	request, err := readRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	response, err := analyzePUCT(r.Context(), session.node, request.Iterations, request.Millis, session.rng)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	response.Session = id
+	response.History = MovesString(session.moves)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleDeleteSession ends a game.
+func (s *AnalysisServer) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id, session := s.session(w, r)
+	if session == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// analyzePUCT searches from root (keeping the tree) and returns the statistics of its moves.
+// iterations and millis limit the search, see the description of the endpoints.
+// The search stops early if ctx is cancelled (the client went away).
+func analyzePUCT(ctx context.Context, root *PUCTNode, iterations int, millis int64, rng *rand.Rand) (AnalysisResponse, error) {
+	if iterations < 0 || iterations > SERVER_MAX_ITERATIONS {
+		return AnalysisResponse{}, fmt.Errorf("iterations must be between 0 and %d", SERVER_MAX_ITERATIONS)
+	}
+	if millis < 0 || millis > SERVER_MAX_MILLIS {
+		return AnalysisResponse{}, fmt.Errorf("millis must be between 0 and %d", SERVER_MAX_MILLIS)
+	}
+	if iterations == 0 && millis == 0 {
+		iterations = SERVER_DEFAULT_ITERATIONS
+	}
+	state := root.GameState
+	response := AnalysisResponse{PositionResponse: positionResponse(state), Analysis: []MoveAnalysis{}}
+	if IsTerminalState(state) {
+		return response, nil
+	}
+	start := time.Now()
+
+	if ShouldSolve(state) {
+		// The solves get half of the time, if they do not finish the moves are searched with the rest
+		budget := time.Duration(millis) * time.Millisecond
+		if millis == 0 {
+			budget = SERVER_MAX_MILLIS * time.Millisecond
+		}
+		if scores, err := SolveMovesContext(ctx, state, Limits{Deadline: start.Add(budget / 2)}); err == nil {
+			response.Solved = true
+			for move, score := range scores {
+				response.Analysis = append(response.Analysis, MoveAnalysis{
+					Move:   MoveString(move),
+					Visits: root.N[move],
+					Q:      root.Q[move],
+					Prior:  root.P[move],
+					Score:  &score,
+				})
+			}
+			sort.Slice(response.Analysis, func(i, j int) bool {
+				a, b := response.Analysis[i], response.Analysis[j]
+				return *a.Score > *b.Score || (*a.Score == *b.Score && a.Move < b.Move)
+			})
+		}
+	}
+	if !response.Solved {
+		limits := Limits{Iterations: iterations}
+		if millis > 0 {
+			limits.Deadline = start.Add(time.Duration(millis) * time.Millisecond)
+		}
+		_, response.Iterations = RootAfterMCTSPUCTContext(ctx, root, limits, rng)
+		for _, child := range root.Children {
+			// The search only keeps one of the symmetric moves, they all get its statistics
+			for _, move := range state.Boards.SymmetricMoves(child.Move) {
+				response.Analysis = append(response.Analysis, MoveAnalysis{
+					Move:   MoveString(move),
+					Visits: root.N[child.Move],
+					Q:      root.Q[child.Move],
+					Prior:  root.P[child.Move],
+				})
+			}
+		}
+		sort.SliceStable(response.Analysis, func(i, j int) bool {
+			a, b := response.Analysis[i], response.Analysis[j]
+			return a.Visits > b.Visits || (a.Visits == b.Visits && a.Q > b.Q)
+		})
+	}
+	if len(response.Analysis) > 0 {
+		response.Best = response.Analysis[0].Move
+	}
+	response.Millis = time.Since(start).Milliseconds()
+	return response, nil
+}
+
+// ServeAnalysis runs the analysis server on the address until it fails.
+// The live game server (see gameserver.go) is on the same address at /play.
+func ServeAnalysis(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/", NewAnalysisServer().Handler())
+	mux.Handle("GET /play", NewGameServer(GAME_SERVER_MAX_SESSIONS, runtime.NumCPU()))
+	return http.ListenAndServe(addr, mux)
+}
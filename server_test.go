@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// request sends a JSON request to the server and decodes the answer into out (if not nil).
+func request(t *testing.T, server *httptest.Server, method, path string, body any, out any) int {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, server.URL+path, &reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAnalysisServerStateless(t *testing.T) {
+	server := httptest.NewServer(NewAnalysisServer().Handler())
+	defer server.Close()
+	start := InitialState()
+
+	var moves PositionResponse
+	if status := request(t, server, "POST", "/moves", analysisRequest{Position: start.PositionString()}, &moves); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if len(moves.Moves) != 4 || !moves.BlackTurn || moves.GameOver {
+		t.Errorf("moves of the start position = %+v", moves)
+	}
+
+	var after PositionResponse
+	request(t, server, "POST", "/move", analysisRequest{Position: start.PositionString(), Move: "d3"}, &after)
+	want := start
+	want.ApplyMove(19)
+	if after.Position != want.PositionString() || after.Score != [2]int{4, 1} {
+		t.Errorf("after d3 = %+v", after)
+	}
+	var failure map[string]string
+	if status := request(t, server, "POST", "/move", analysisRequest{Position: start.PositionString(), Move: "a1"}, &failure); status != http.StatusBadRequest || failure["error"] == "" {
+		t.Errorf("illegal move answered %d %v", status, failure)
+	}
+
+	var analysis AnalysisResponse
+	request(t, server, "POST", "/analyze", analysisRequest{Position: after.Position, Iterations: 300}, &analysis)
+	if analysis.Iterations != 300 || len(analysis.Analysis) != 3 || analysis.Best != analysis.Analysis[0].Move {
+		t.Errorf("analysis = %+v", analysis)
+	}
+	visits := 0
+	for _, move := range analysis.Analysis {
+		visits += move.Visits
+	}
+	if visits != 300 {
+		t.Errorf("visits of the moves add up to %d, want 300", visits)
+	}
+	var opening AnalysisResponse
+	request(t, server, "POST", "/analyze", analysisRequest{Position: start.PositionString(), Iterations: 100}, &opening)
+	if len(opening.Analysis) != 4 || opening.Analysis[0].Visits != opening.Analysis[3].Visits {
+		t.Errorf("the symmetric opening moves are not all analyzed: %+v", opening.Analysis)
+	}
+	if status := request(t, server, "POST", "/analyze", analysisRequest{Position: after.Position, Millis: -1}, nil); status != http.StatusBadRequest {
+		t.Errorf("negative millis answered %d", status)
+	}
+}
+
+func TestAnalysisServerSessions(t *testing.T) {
+	server := httptest.NewServer(NewAnalysisServer().Handler())
+	defer server.Close()
+
+	var session PositionResponse
+	if status := request(t, server, "POST", "/sessions", nil, &session); status != http.StatusCreated || session.Session == "" {
+		t.Fatalf("new session answered %d %+v", status, session)
+	}
+	path := "/sessions/" + session.Session
+	request(t, server, "POST", path+"/move", analysisRequest{Move: "f5"}, &session)
+	var first, second AnalysisResponse
+	request(t, server, "POST", path+"/analyze", analysisRequest{Iterations: 200}, &first)
+	request(t, server, "POST", path+"/analyze", analysisRequest{Iterations: 200}, &second)
+	visits := 0
+	for _, move := range second.Analysis {
+		visits += move.Visits
+	}
+	if visits != 400 {
+		t.Errorf("the tree was not kept between calls, %d visits after 2 analyses of 200", visits)
+	}
+	request(t, server, "POST", path+"/move", analysisRequest{Move: second.Best}, &session)
+	if session.History != "f5"+second.Best || !session.BlackTurn {
+		t.Errorf("session after f5 %s = %+v", second.Best, session)
+	}
+	var current PositionResponse
+	request(t, server, "GET", path, nil, &current)
+	if current.Position != session.Position {
+		t.Errorf("GET session = %+v, want %+v", current, session)
+	}
+	if status := request(t, server, "DELETE", path, nil, nil); status != http.StatusNoContent {
+		t.Errorf("delete answered %d", status)
+	}
+	if status := request(t, server, "GET", path, nil, nil); status != http.StatusNotFound {
+		t.Errorf("deleted session answered %d", status)
+	}
+}
+
+func TestAnalysisServerSolves(t *testing.T) {
+	server := httptest.NewServer(NewAnalysisServer().Handler())
+	defer server.Close()
+	state := randomPositionWithEmpties(10, rand.New(rand.NewSource(6)))
+	var analysis AnalysisResponse
+	request(t, server, "POST", "/analyze", analysisRequest{Position: state.PositionString()}, &analysis)
+	best := SolveEndgame(state)
+	if !analysis.Solved || analysis.Analysis[0].Score == nil || *analysis.Analysis[0].Score != best.Score {
+		t.Errorf("analysis = %+v, solver score %d", analysis, best.Score)
+	}
+}
+
+func TestAnalysisServerSearchesWhenTheSolveDoesNotFit(t *testing.T) {
+	server := httptest.NewServer(NewAnalysisServer().Handler())
+	defer server.Close()
+	state := randomPositionWithEmpties(EndgameEmpties, rand.New(rand.NewSource(4)))
+	var analysis AnalysisResponse
+	request(t, server, "POST", "/analyze", analysisRequest{Position: state.PositionString(), Millis: 20}, &analysis)
+	if analysis.Solved || analysis.Iterations == 0 || len(analysis.Analysis) == 0 {
+		t.Errorf("analysis in 20ms = %+v, want the search", analysis)
+	}
+	if analysis.Millis > 200 {
+		t.Errorf("the analysis of 20ms took %dms", analysis.Millis)
+	}
+}
+
+func TestAnalysisServerEvictsSessions(t *testing.T) {
+	analysisServer := NewAnalysisServer()
+	analysisServer.MaxSessions = 2
+	server := httptest.NewServer(analysisServer.Handler())
+	defer server.Close()
+	var sessions [4]PositionResponse
+	for i := range sessions {
+		request(t, server, "POST", "/sessions", nil, &sessions[i])
+		if i == 1 {
+			request(t, server, "GET", "/sessions/"+sessions[0].Session, nil, nil) // The first one is used again
+		}
+	}
+	// The second one was the least recently used when the third started, then the first one
+	for i, want := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusOK, http.StatusOK} {
+		if status := request(t, server, "GET", "/sessions/"+sessions[i].Session, nil, nil); status != want {
+			t.Errorf("session %d answered %d, want %d", i, status, want)
+		}
+	}
+}
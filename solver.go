@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"time"
+)
+
+// Endgame solver: once few empty squares remain the game tree is small enough
+// to be searched completely, so instead of estimating with random rollouts we
+// compute the exact result with negamax and alpha-beta pruning.
+
+// EndgameEmpties is the number of empty squares at (or below) which the MCTS entry points
+// hand the position over to the exact solver. Set it to 0 to disable the solver.
+var EndgameEmpties = 16
+
+// PASS_MOVE is used inside move sequences (like the principal variation) to mark a forced pass.
+const PASS_MOVE uint8 = 64
+
+// MAX_PLY is the maximum length of a line from any position to the end of the game (moves and passes).
+const MAX_PLY = 128
+
+// sortingEmpties is the number of empties above which the solver orders moves by opponent mobility.
+// Below it the cost of sorting is higher than what it saves.
+const sortingEmpties = 7
+
+// tableEmpties is the number of empties from which the solver uses the transposition table.
+// Close to the end the subtrees are so small that they are cheaper to search than to look up.
+const tableEmpties = 8
+
+// ENDGAME_TABLE_SIZE is the number of entries of the transposition table of each solve.
+const ENDGAME_TABLE_SIZE = 1 << 18
+
+// SOLVER_CHECK_INTERVAL is the number of positions between checks of the limits of a solve (a power of 2).
+const SOLVER_CHECK_INTERVAL = 1 << 12
+
+// ErrSolveStopped is returned when a solve reaches its limits (or its context is cancelled) before the end.
+var ErrSolveStopped = errors.New("solve stopped before the end")
+
+// EndgameResult is the outcome of solving a position exactly.
+type EndgameResult struct {
+	Score    int     // Final disc differential from the point of view of the side to move
+	BestMove uint8   // Best move for the side to move (PASS_MOVE if it has to pass)
+	PV       []uint8 // Principal variation, the line of perfect play until the end of the game
+	Nodes    int     // Number of positions visited
+}
+
+// endgameBound is what the solver stores in the transposition table.
+// The exact score of the position is known to be between Lower and Upper (equal if it is exact).
+type endgameBound struct {
+	Lower    int8
+	Upper    int8
+	BestMove uint8
+}
+
+// endgameSolver keeps the state of the solves of a position so that the recursion does not allocate.
+type endgameSolver struct {
+	nodes   int
+	pv      [MAX_PLY][MAX_PLY]uint8 // Triangular table, pv[ply] holds the best line found from ply
+	pvLen   [MAX_PLY]int
+	table   *TranspositionTable[endgameBound]
+	ctx     context.Context
+	limits  Limits
+	stopped bool // The limits were reached, the scores being computed are not valid
+}
+
+// newEndgameSolver returns a solver that stops at the Deadline and at MaxNodes positions of the limits
+// (for all its solves), or when ctx is cancelled.
+func newEndgameSolver(ctx context.Context, limits Limits) *endgameSolver {
+	return &endgameSolver{table: NewTranspositionTable[endgameBound](ENDGAME_TABLE_SIZE), ctx: ctx, limits: limits}
+}
+
+// limitReached returns true if the solve must stop.
+func (s *endgameSolver) limitReached() bool {
+	switch {
+	case s.limits.MaxNodes > 0 && s.nodes >= s.limits.MaxNodes:
+		return true
+	case !s.limits.Deadline.IsZero() && !time.Now().Before(s.limits.Deadline):
+		return true
+	}
+	return s.ctx.Err() != nil
+}
+
+// EmptySquares returns the number of empty squares on the board.
+func (b *Board) EmptySquares() int {
+	return 64 - bits.OnesCount64(b.Black|b.White)
+}
+
+// ShouldSolve returns true if the state is close enough to the end of the game to use the solver.
+func ShouldSolve(state State) bool {
+	return EndgameEmpties > 0 && state.Boards.EmptySquares() <= EndgameEmpties && !IsTerminalState(state)
+}
+
+// finalDiscDifferential returns the final score of a finished game for the owner of myDisks.
+// Following the usual convention the empty squares are awarded to the winner.
+func finalDiscDifferential(myDisks, oppDisks uint64) int {
+	my := bits.OnesCount64(myDisks)
+	opp := bits.OnesCount64(oppDisks)
+	empties := 64 - my - opp
+	switch {
+	case my > opp:
+		return my - opp + empties
+	case my < opp:
+		return my - opp - empties
+	default:
+		return 0
+	}
+}
+
+// SolveEndgame searches the given state until the end of the game and returns the exact result.
+// It is meant for positions with few empty squares (see EndgameEmpties), the cost grows exponentially.
+func SolveEndgame(state State) EndgameResult {
+	result, _ := SolveEndgameContext(context.Background(), state, Limits{})
+	return result
+}
+
+// SolveEndgameContext is SolveEndgame until the Deadline or MaxNodes (positions visited) of the limits
+// are reached or ctx is cancelled, the other limits do not apply.
+// Returns ErrSolveStopped if the solve did not finish, the result is not valid then.
+func SolveEndgameContext(ctx context.Context, state State, limits Limits) (EndgameResult, error) {
+	solver := newEndgameSolver(ctx, limits)
+	result := solver.solve(state)
+	if solver.stopped {
+		return result, ErrSolveStopped
+	}
+	return result, nil
+}
+
+// solve returns the exact result of the state, or an invalid one if the solver stops.
+func (s *endgameSolver) solve(state State) EndgameResult {
+	var myDisks, oppDisks uint64
+	if state.BlackTurn {
+		myDisks, oppDisks = state.Boards.Black, state.Boards.White
+	} else {
+		myDisks, oppDisks = state.Boards.White, state.Boards.Black
+	}
+	hash := state.Boards.ZobristHash(state.BlackTurn)
+	nodes := s.nodes
+	score := s.negamax(myDisks, oppDisks, state.BlackTurn, hash, -64, 64, 0)
+
+	pv := make([]uint8, s.pvLen[0])
+	copy(pv, s.pv[0][:s.pvLen[0]])
+	result := EndgameResult{
+		Score:    score,
+		BestMove: PASS_MOVE,
+		PV:       pv,
+		Nodes:    s.nodes - nodes,
+	}
+	if len(pv) > 0 {
+		result.BestMove = pv[0]
+	}
+	return result
+}
+
+// negamax returns the exact score for the owner of myDisks, searching inside the window (alpha, beta).
+// It is a principal variation search: after the first move the rest are tried with a null window,
+// and only searched again with the full window if they turn out to be better.
+// forBlack tells the color of the owner of myDisks, and hash is the Zobrist hash of the position.
+// It returns 0 as soon as the limits of the solver are reached, see stopped.
+func (s *endgameSolver) negamax(myDisks, oppDisks uint64, forBlack bool, hash uint64, alpha, beta int, ply int) int {
+	if s.stopped {
+		return 0
+	}
+	s.nodes++
+	s.pvLen[ply] = 0
+	if s.nodes&(SOLVER_CHECK_INTERVAL-1) == 0 && s.limitReached() {
+		s.stopped = true
+		return 0
+	}
+
+	moves := generateMoves(myDisks, oppDisks)
+	if moves == 0 {
+		if generateMoves(oppDisks, myDisks) == 0 {
+			return finalDiscDifferential(myDisks, oppDisks) // Nobody can move, game over
+		}
+		// Pass the turn, the score of the opponent is the negative of ours
+		score := -s.negamax(oppDisks, myDisks, !forBlack, hash^zobristBlackTurn, -beta, -alpha, ply+1)
+		s.updatePV(ply, PASS_MOVE)
+		return score
+	}
+
+	// Look for what we already know about this position
+	useTable := 64-bits.OnesCount64(myDisks|oppDisks) >= tableEmpties
+	tableMove := PASS_MOVE
+	originalAlpha, originalBeta := alpha, beta
+	if useTable {
+		if bound, found := s.table.Lookup(hash); found {
+			tableMove = bound.BestMove
+			lower, upper := int(bound.Lower), int(bound.Upper)
+			// Only cut in null window searches, that way the principal variation stays complete
+			if beta-alpha == 1 {
+				if lower >= beta {
+					return lower
+				}
+				if upper <= alpha {
+					return upper
+				}
+			}
+		}
+	}
+
+	bestScore := -65
+	bestMove := PASS_MOVE
+	var buffer [33]uint8 // Maximum number of legal moves (see FastArrayOfMoves)
+	for i, move := range s.orderMoves(myDisks, oppDisks, moves, tableMove, buffer[:0]) {
+		newMy, newOpp := myDisks, oppDisks // Copy
+		captured := ResolveMove(&newMy, &newOpp, move)
+		newHash := hash ^ zobristMoveDelta(forBlack, move, captured) ^ zobristBlackTurn
+		var score int
+		if i == 0 {
+			score = -s.negamax(newOpp, newMy, !forBlack, newHash, -beta, -alpha, ply+1)
+		} else {
+			score = -s.negamax(newOpp, newMy, !forBlack, newHash, -alpha-1, -alpha, ply+1)
+			if score > alpha && score < beta {
+				score = -s.negamax(newOpp, newMy, !forBlack, newHash, -beta, -score, ply+1)
+			}
+		}
+		if s.stopped {
+			return 0 // Nothing of this position is known, it must not be stored
+		}
+		if score > bestScore {
+			bestScore = score
+			bestMove = move
+			s.updatePV(ply, move)
+			if score > alpha {
+				alpha = score
+				if alpha >= beta {
+					break // Cut-off, the opponent will never allow this line
+				}
+			}
+		}
+	}
+
+	if useTable {
+		bound := endgameBound{Lower: -64, Upper: 64, BestMove: bestMove}
+		if bestScore > originalAlpha {
+			bound.Lower = int8(bestScore)
+		}
+		if bestScore < originalBeta {
+			bound.Upper = int8(bestScore)
+		}
+		s.table.Store(hash, 64-bits.OnesCount64(myDisks|oppDisks), bound)
+	}
+	return bestScore
+}
+
+// updatePV sets move as the first move of the line at ply followed by the line found at ply+1.
+func (s *endgameSolver) updatePV(ply int, move uint8) {
+	s.pv[ply][0] = move
+	copy(s.pv[ply][1:], s.pv[ply+1][:s.pvLen[ply+1]])
+	s.pvLen[ply] = s.pvLen[ply+1] + 1
+}
+
+// orderMoves returns the moves to try, first the best move stored in the table (PASS_MOVE if none) and
+// then the ones that leave the opponent with fewest replies.
+// Good moves first means more alpha-beta cut-offs. The moves are appended to moveArray to avoid allocations.
+func (s *endgameSolver) orderMoves(myDisks, oppDisks, moves uint64, tableMove uint8, moveArray []uint8) []uint8 {
+	for m := moves; m != 0; m &= m - 1 {
+		moveArray = append(moveArray, uint8(bits.TrailingZeros64(m)))
+	}
+	if 64-bits.OnesCount64(myDisks|oppDisks) <= sortingEmpties {
+		return moveArray
+	}
+	var mobility [64]int
+	for _, move := range moveArray {
+		if move == tableMove {
+			mobility[move] = -1 // Always first
+			continue
+		}
+		newMy, newOpp := myDisks, oppDisks
+		ResolveMove(&newMy, &newOpp, move)
+		mobility[move] = bits.OnesCount64(generateMoves(newOpp, newMy))
+	}
+	// Insertion sort, there are never many moves
+	for i := 1; i < len(moveArray); i++ {
+		for j := i; j > 0 && mobility[moveArray[j]] < mobility[moveArray[j-1]]; j-- {
+			moveArray[j], moveArray[j-1] = moveArray[j-1], moveArray[j]
+		}
+	}
+	return moveArray
+}
+
+// SolveMoves returns the exact score of every legal move of the state, from the point of view of the side to move.
+// It costs a solve per move, use SolveEndgame when only the best move is needed.
+func SolveMoves(state State) map[uint8]int {
+	scores, _ := SolveMovesContext(context.Background(), state, Limits{})
+	return scores
+}
+
+// SolveMovesContext is SolveMoves until the Deadline or MaxNodes (positions visited by all the solves)
+// of the limits are reached or ctx is cancelled. Returns ErrSolveStopped if the solves did not finish,
+// the scores are not valid then.
+func SolveMovesContext(ctx context.Context, state State, limits Limits) (map[uint8]int, error) {
+	solver := newEndgameSolver(ctx, limits) // The moves share the table, their subtrees have transpositions
+	scores := make(map[uint8]int)
+	for _, move := range FastArrayOfMoves(legalMovesOf(state)) {
+		next := state
+		next.ApplyMove(move)
+		score := solver.solve(next).Score
+		if solver.stopped {
+			return scores, ErrSolveStopped
+		}
+		if next.BlackTurn != state.BlackTurn {
+			score = -score
+		}
+		scores[move] = score
+	}
+	return scores, nil
+}
+
+// SolvedBestNode returns the child of node for the best move according to the exact solver.
+func SolvedBestNode(node *Node) *Node {
+	result := SolveEndgame(node.GameState)
+	return node.ChildForMove(result.BestMove)
+}
+
+// SolvedBestNodePUCT returns the child of node for the best move according to the exact solver.
+func SolvedBestNodePUCT(node *PUCTNode) *PUCTNode {
+	result := SolveEndgame(node.GameState)
+	return node.ChildForMovePUCT(result.BestMove)
+}
+
+// solvedBestNodeWithin is SolvedBestNode within the limits (see SolveEndgameContext).
+// Returns nil if the solve did not finish, the searches use MCTS then.
+func solvedBestNodeWithin(ctx context.Context, node *Node, limits Limits) *Node {
+	result, err := SolveEndgameContext(ctx, node.GameState, limits)
+	if err != nil {
+		return nil
+	}
+	return node.ChildForMove(result.BestMove)
+}
+
+// solvedBestNodePUCTWithin is solvedBestNodeWithin for PUCTNode trees.
+func solvedBestNodePUCTWithin(ctx context.Context, node *PUCTNode, limits Limits) *PUCTNode {
+	result, err := SolveEndgameContext(ctx, node.GameState, limits)
+	if err != nil {
+		return nil
+	}
+	return node.ChildForMovePUCT(result.BestMove)
+}
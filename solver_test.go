@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// minimaxScore returns the exact score of the state for the side to move, searching every line without pruning.
+func minimaxScore(state State) int {
+	moves := legalMovesOf(state)
+	if moves == 0 {
+		passed := state
+		passed.BlackTurn = !passed.BlackTurn
+		if legalMovesOf(passed) == 0 {
+			my, opp := state.Boards.White, state.Boards.Black
+			if state.BlackTurn {
+				my, opp = opp, my
+			}
+			return finalDiscDifferential(my, opp)
+		}
+		return -minimaxScore(passed)
+	}
+	best := -65
+	for _, move := range FastArrayOfMoves(moves) {
+		next := state
+		next.Boards.MakeMoveIndex(next.BlackTurn, move)
+		next.BlackTurn = !next.BlackTurn // The pass (if any) is found by the recursion
+		if score := -minimaxScore(next); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// solverTestPositions returns random positions with the empties, also with the other side to move
+// (which may have to pass) when the game is not over for it.
+func solverTestPositions(empties, count int, rng *rand.Rand) []State {
+	var states []State
+	for len(states) < count {
+		state := randomPositionWithEmpties(empties, rng)
+		states = append(states, state)
+		other := state
+		other.BlackTurn = !other.BlackTurn
+		if !IsTerminalState(other) {
+			states = append(states, other)
+		}
+	}
+	return states
+}
+
+func TestSolveEndgameAgreesWithMinimax(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for empties := 1; empties <= 9; empties++ {
+		for _, state := range solverTestPositions(empties, 20, rng) {
+			want := minimaxScore(state)
+			if got := SolveEndgame(state).Score; got != want {
+				t.Errorf("%s: solver score %d, minimax %d", state.PositionString(), got, want)
+			}
+		}
+	}
+}
+
+func TestSolveMovesAgreesWithMinimax(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, state := range solverTestPositions(8, 10, rng) {
+		scores := SolveMoves(state)
+		for _, move := range FastArrayOfMoves(legalMovesOf(state)) {
+			next := state
+			next.Boards.MakeMoveIndex(next.BlackTurn, move)
+			next.BlackTurn = !next.BlackTurn
+			if want := -minimaxScore(next); scores[move] != want {
+				t.Errorf("%s: %s scores %d, minimax %d", state.PositionString(), MoveString(move), scores[move], want)
+			}
+		}
+	}
+}
+
+func TestSolveEndgamePVReachesScore(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, empties := range []int{4, 8, 12} {
+		for _, state := range solverTestPositions(empties, 10, rng) {
+			result := SolveEndgame(state)
+			if len(result.PV) == 0 || result.BestMove != result.PV[0] {
+				t.Fatalf("%s: best move %s, pv %v", state.PositionString(), MoveString(result.BestMove), result.PV)
+			}
+			// Replay the principal variation, passing explicitly where it says so
+			board, blackTurn := state.Boards, state.BlackTurn
+			for i, move := range result.PV {
+				var moves uint64
+				if blackTurn {
+					moves = generateMoves(board.Black, board.White)
+				} else {
+					moves = generateMoves(board.White, board.Black)
+				}
+				if move == PASS_MOVE {
+					if moves != 0 {
+						t.Fatalf("%s: pv move %d is a pass with legal moves", state.PositionString(), i)
+					}
+				} else {
+					if moves&(1<<move) == 0 {
+						t.Fatalf("%s: pv move %d %s is not legal", state.PositionString(), i, MoveString(move))
+					}
+					board.MakeMoveIndex(blackTurn, move)
+				}
+				blackTurn = !blackTurn
+			}
+			if board.HasValidMove(true) || board.HasValidMove(false) {
+				t.Fatalf("%s: the game is not over after the pv %v", state.PositionString(), result.PV)
+			}
+			my, opp := board.White, board.Black
+			if state.BlackTurn {
+				my, opp = opp, my
+			}
+			if got := finalDiscDifferential(my, opp); got != result.Score {
+				t.Errorf("%s: the pv ends with %d, the score is %d", state.PositionString(), got, result.Score)
+			}
+		}
+	}
+}
+
+func TestSolveEndgameContextStops(t *testing.T) {
+	state := randomPositionWithEmpties(16, rand.New(rand.NewSource(4)))
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, limits := range map[string]Limits{
+		"nodes":    {MaxNodes: 10000},
+		"deadline": {Deadline: time.Now()},
+	} {
+		result, err := SolveEndgameContext(context.Background(), state, limits)
+		if !errors.Is(err, ErrSolveStopped) || result.Nodes > 10000+SOLVER_CHECK_INTERVAL {
+			t.Errorf("%s: %v after %d nodes, want it stopped", name, err, result.Nodes)
+		}
+	}
+	if _, err := SolveEndgameContext(cancelled, state, Limits{}); !errors.Is(err, ErrSolveStopped) {
+		t.Errorf("cancelled: %v, want it stopped", err)
+	}
+	if _, err := SolveMovesContext(cancelled, state, Limits{}); !errors.Is(err, ErrSolveStopped) {
+		t.Errorf("cancelled moves: %v, want them stopped", err)
+	}
+
+	// A stopped solve leaves nothing wrong behind, the limits that are not reached do not change the result
+	small := randomPositionWithEmpties(10, rand.New(rand.NewSource(5)))
+	result, err := SolveEndgameContext(context.Background(), small, Limits{Iterations: 1, Deadline: time.Now().Add(time.Minute), MaxNodes: 1 << 30})
+	if err != nil || result.Score != SolveEndgame(small).Score {
+		t.Errorf("bounded solve %d %v, the solver says %d", result.Score, err, SolveEndgame(small).Score)
+	}
+	scores, err := SolveMovesContext(context.Background(), small, Limits{Deadline: time.Now().Add(time.Minute)})
+	if err != nil || !maps.Equal(scores, SolveMoves(small)) {
+		t.Errorf("bounded moves %v %v, want %v", scores, err, SolveMoves(small))
+	}
+}
+
+func TestSearchesFallBackWhenTheSolveStops(t *testing.T) {
+	state := randomPositionWithEmpties(16, rand.New(rand.NewSource(4)))
+	limits := Limits{Iterations: 50, MaxNodes: 10000}
+	rng := rand.New(rand.NewSource(1))
+	if best, playouts := MonteCarloTreeSearchPUCTContext(context.Background(), NewPUCTNode(state, nil, PASS_MOVE), limits, rng); best == nil || playouts == 0 {
+		t.Errorf("PUCT: %d playouts, want the search after the stopped solve", playouts)
+	}
+	if best, playouts := OriginalMonteCarloTreeSearchContext(context.Background(), NewNode(state, nil, PASS_MOVE), limits, rng); best == nil || playouts == 0 {
+		t.Errorf("UCT: %d playouts, want the search after the stopped solve", playouts)
+	}
+	small := randomPositionWithEmpties(10, rng)
+	if _, playouts := MonteCarloTreeSearchPUCTContext(context.Background(), NewPUCTNode(small, nil, PASS_MOVE), limits, rng); playouts != 0 {
+		t.Errorf("%d playouts, the solve of 10 empties fits in the limits", playouts)
+	}
+}
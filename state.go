@@ -1,10 +1,15 @@
 package main
 
-import "math/bits"
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
 
 type State struct {
 	Boards    Board
 	BlackTurn bool
+	Hash      uint64 // Zobrist hash of the position, kept up to date by ApplyMove
 }
 
 // Board holds bitboards for black and white disks (disjoint).
@@ -35,9 +40,10 @@ const (
 // --- Core Board Methods ---
 
 // CellState returns the state of the cell at (row, col).
+// It panics if the cell is out of range (see TryCellState).
 func (b *Board) CellState(row, col int) CellState {
-	if row < 0 || row > 7 || col < 0 || col > 7 {
-		panic("row/col out of range")
+	if err := checkCoordinates(row, col); err != nil {
+		panic(err)
 	}
 
 	mask := uint64(1) << (row*8 + col)
@@ -73,9 +79,10 @@ func (b *Board) CountOfPieces(forBlack bool) int {
 }
 
 // SetCellState sets a cell to black, white, or empty.
+// It panics if the cell is out of range (see TrySetCellState).
 func (b *Board) SetCellState(row, col int, state CellState) {
-	if row < 0 || row > 7 || col < 0 || col > 7 {
-		panic("row/col out of range")
+	if err := checkCoordinates(row, col); err != nil {
+		panic(err)
 	}
 
 	mask := uint64(1) << (row*8 + col)
@@ -110,69 +117,52 @@ func (b *Board) Init() {
 // NUM_DIRS cardinal directions you can shift to (horizontal, vertical, and diagonals).
 const NUM_DIRS = 8
 
-// shift moves all bits in the bitboard disks one step in a given direction.
+// direction is one of the NUM_DIRS directions, a shift of the bitboard by one square.
+type direction struct {
+	lshift uint   // Shift to the left (up or left), 0 if it shifts right
+	rshift uint   // Shift to the right (down or right), 0 if it shifts left
+	mask   uint64 // We use the mask so that when shifting the bits do not wrap around
+}
+
+// directions are all the directions, a fixed array so that a direction can never be invalid.
+var directions = [NUM_DIRS]direction{
+	{rshift: 1, mask: 0x7F7F7F7F7F7F7F7F}, // Right
+	{rshift: 9, mask: 0x007F7F7F7F7F7F7F}, // Down-right
+	{rshift: 8, mask: 0xFFFFFFFFFFFFFFFF}, // Down
+	{rshift: 7, mask: 0x00FEFEFEFEFEFEFE}, // Down-left
+	{lshift: 1, mask: 0xFEFEFEFEFEFEFEFE}, // Left
+	{lshift: 9, mask: 0xFEFEFEFEFEFEFE00}, // Up-left
+	{lshift: 8, mask: 0xFFFFFFFFFFFFFFFF}, // Up
+	{lshift: 7, mask: 0x7F7F7F7F7F7F7F00}, // Up-right
+}
+
+// shift moves all bits in the bitboard disks one step in the direction.
 // This is needed so that we can do bitboard operations on a bitboard.
 // We use it to calculate using bitoperations the possible moves and resulting captures.
-func shift(disks uint64, dir int) uint64 {
-	if dir < 0 || dir >= NUM_DIRS {
-		panic("invalid direction")
-	}
-	// We use the MASKS so that when shifting the bits do not wrap around
-	var MASKS = [NUM_DIRS]uint64{
-		0x7F7F7F7F7F7F7F7F, // Right
-		0x007F7F7F7F7F7F7F, // Down-right
-		0xFFFFFFFFFFFFFFFF, // Down
-		0x00FEFEFEFEFEFEFE, // Down-left
-		0xFEFEFEFEFEFEFEFE, // Left
-		0xFEFEFEFEFEFEFE00, // Up-left
-		0xFFFFFFFFFFFFFFFF, // Up
-		0x7F7F7F7F7F7F7F00, // Up-right
-	}
-
-	var LSHIFTS = [NUM_DIRS]uint{
-		0, // Right
-		0, // Down-right
-		0, // Down
-		0, // Down-left
-		1, // Left
-		9, // Up-left
-		8, // Up
-		7, // Up-right
-	}
-
-	var RSHIFTS = [NUM_DIRS]uint{
-		1, // Right
-		9, // Down-right
-		8, // Down
-		7, // Down-left
-		0, // Left
-		0, // Up-left
-		0, // Up
-		0, // Up-right
-	}
-
-	if dir < NUM_DIRS/2 {
-		// Shifting right
-		return (disks >> RSHIFTS[dir]) & MASKS[dir]
-	}
-	// Shifting left
-	return (disks << LSHIFTS[dir]) & MASKS[dir]
+func (dir direction) shift(disks uint64) uint64 {
+	return (disks >> dir.rshift << dir.lshift) & dir.mask
 }
 
 // generateMoves returns a bitboard where the 1s represent valid places to put the disk.
 // The bitboards should be provided in order as to get the result of where the user (myDisks) can move.
-// Uses the Dumb7fill algorithm to use the bitboard to get the valid moves.
+// The implementation is selected with MoveGenerator (see movegen.go).
 func generateMoves(myDisks, oppDisks uint64) uint64 {
+	return MoveGenerator(myDisks, oppDisks)
+}
+
+// Dumb7fillMoves returns a bitboard where the 1s represent valid places to put the disk.
+// Uses the Dumb7fill algorithm to use the bitboard to get the valid moves.
+func Dumb7fillMoves(myDisks, oppDisks uint64) uint64 {
 	empty := ^(myDisks | oppDisks)
 	var legalMoves uint64
 
-	for dir := 0; dir < NUM_DIRS; dir++ {
-		x := shift(myDisks, dir) & oppDisks // x is where there are my disk and next to them the opponents disk
-		for i := 0; i < 6; i++ {            // repeat 6 more times to cover up to 7 squares
+	for _, dir := range directions {
+		x := dir.shift(myDisks) & oppDisks // x is where there are my disk and next to them the opponents disk
+		for i := 0; i < 6; i++ {           // repeat 6 more times to cover up to 7 squares
 			// The x in the expression is to keep track of the previous sequences
-			x = x | (shift(x, dir) & oppDisks) // Add to x the oponent disks adjacent to those
+			x = x | (dir.shift(x) & oppDisks) // Add to x the oponent disks adjacent to those
 		}
-		legalMoves = legalMoves | (shift(x, dir) & empty) // After all that if you find a white space it is a legal move
+		legalMoves = legalMoves | (dir.shift(x) & empty) // After all that if you find a white space it is a legal move
 	}
 
 	return legalMoves
@@ -256,56 +246,139 @@ func (b *Board) IsValidMoveIndex(forBlack bool, index uint8) bool {
 	return generateMoves(b.White, b.Black)&mask != 0
 }
 
-// ResolveMove updates the boards with the captures achieved by the move.
-// Once a move is made we update the board (the sandwhiched disks need to change colors)
-// moveIndex should be a number that represents a position in the uint64 so it can range from 0 to 63
-func ResolveMove(myDisks, oppDisks *uint64, moveIndex uint8) {
+// Flips returns the bitboard of the opponent disks that would be captured (flipped) by the move.
+// The boards are not modified. The implementation is selected with FlipCalculator (see movegen.go).
+func Flips(myDisks, oppDisks uint64, moveIndex uint8) uint64 {
+	return FlipCalculator(myDisks, oppDisks, moveIndex)
+}
+
+// Dumb7fillFlips returns the bitboard of the opponent disks that would be captured (flipped) by the move.
+func Dumb7fillFlips(myDisks, oppDisks uint64, moveIndex uint8) uint64 {
 	newDisk := uint64(1) << moveIndex
 	var captured uint64
 
-	*myDisks |= newDisk
 	// Use dumb7fill to find captured/sandwhiched disks
-	for dir := 0; dir < NUM_DIRS; dir++ {
-		x := shift(newDisk, dir) & *oppDisks // We mark with 1 only the disks sandwhiched
+	for _, dir := range directions {
+		x := dir.shift(newDisk) & oppDisks // We mark with 1 only the disks sandwhiched
 		for i := 0; i < 6; i++ {
-			x = x | (shift(x, dir) & *oppDisks)
+			x = x | (dir.shift(x) & oppDisks)
 		}
-		boundingDisk := shift(x, dir) & *myDisks
+		boundingDisk := dir.shift(x) & myDisks
 		// If you found captured disks then
 		if boundingDisk != 0 {
 			captured = captured | x
 		}
 	}
+	return captured
+}
 
+// ResolveMove updates the boards with the captures achieved by the move.
+// Once a move is made we update the board (the sandwhiched disks need to change colors)
+// moveIndex should be a number that represents a position in the uint64 so it can range from 0 to 63
+// Returns the bitboard of the captured disks, which is what UnresolveMove needs to undo it.
+func ResolveMove(myDisks, oppDisks *uint64, moveIndex uint8) uint64 {
+	captured := Flips(*myDisks, *oppDisks, moveIndex)
+	*myDisks |= uint64(1) << moveIndex
 	*myDisks ^= captured  // We add the captured ones
 	*oppDisks ^= captured // We substract the captured ones
+	return captured
 }
 
-// MakeMovePositional given a position (in row col format) and a board execute the move.
-func (b *Board) MakeMovePositional(forBlack bool, row, col uint8) {
-	if !b.IsValidMovePositional(forBlack, row, col) {
-		panic("invalid move")
-	}
+// UnresolveMove undoes ResolveMove: removes the disk of the move and gives back the captured disks.
+// flips must be the value returned by ResolveMove for that move.
+func UnresolveMove(myDisks, oppDisks *uint64, moveIndex uint8, flips uint64) {
+	*myDisks &^= uint64(1) << moveIndex
+	*myDisks ^= flips
+	*oppDisks ^= flips
+}
 
-	moveIndex := row*8 + col
+// UnmakeMoveIndex undoes a move made by the player, given the captured disks (see ResolveMove).
+func (b *Board) UnmakeMoveIndex(forBlack bool, index uint8, flips uint64) {
 	if forBlack {
-		ResolveMove(&b.Black, &b.White, moveIndex)
+		UnresolveMove(&b.Black, &b.White, index, flips)
 	} else {
-		ResolveMove(&b.White, &b.Black, moveIndex)
+		UnresolveMove(&b.White, &b.Black, index, flips)
+	}
+}
+
+// MakeMovePositional given a position (in row col format) and a board execute the move.
+// It panics if the move is not valid (see TryMovePositional).
+func (b *Board) MakeMovePositional(forBlack bool, row, col uint8) {
+	if err := b.TryMovePositional(forBlack, row, col); err != nil {
+		panic(err)
 	}
 }
 
 // MakeMoveIndex given a position index and a board execute the move.
+// It panics if the move is not valid (see TryMoveIndex).
 func (b *Board) MakeMoveIndex(forBlack bool, index uint8) {
-	if !b.IsValidMoveIndex(forBlack, index) {
-		panic("invalid move")
+	if err := b.TryMoveIndex(forBlack, index); err != nil {
+		panic(err)
 	}
+}
 
-	if forBlack {
-		ResolveMove(&b.Black, &b.White, index)
+// InitialState returns the state at the start of the game, black moves first.
+func InitialState() State {
+	var state State
+	state.Boards.Init()
+	state.BlackTurn = true
+	state.Hash = state.Boards.ZobristHash(state.BlackTurn)
+	return state
+}
+
+// ApplyMove makes the move (by index) for the player in turn and then gives the turn to the opponent.
+// Edge case: if the opponent cannot move but we can, the opponent passes and the turn comes back.
+// The hash is updated incrementally with the captured disks.
+// It panics if the move is not valid, use TryMove for moves that come from the user.
+func (s *State) ApplyMove(moveIndex uint8) {
+	if err := s.TryMove(s.BlackTurn, moveIndex); err != nil {
+		panic(err)
+	}
+}
+
+// MoveRecord has what is needed to undo a move made on a State.
+type MoveRecord struct {
+	Move      uint8
+	Flips     uint64 // Captured disks
+	BlackTurn bool   // Player who made the move (the turn before it)
+	Hash      uint64 // Hash before the move
+}
+
+// MakeMove makes the move for the player in turn like ApplyMove, and returns the record to undo it with Unmake.
+// Returns an error if the move cannot be made (see TryMove), the state is not modified in that case.
+func (s *State) MakeMove(moveIndex uint8) (MoveRecord, error) {
+	if err := s.checkMove(s.BlackTurn, moveIndex); err != nil {
+		return MoveRecord{}, err
+	}
+	return s.applyMove(moveIndex), nil
+}
+
+// Unmake restores the state to what it was before the move of the record.
+// Records must be undone in the reverse order they were made.
+func (s *State) Unmake(record MoveRecord) {
+	s.Boards.UnmakeMoveIndex(record.BlackTurn, record.Move, record.Flips)
+	s.BlackTurn = record.BlackTurn
+	s.Hash = record.Hash
+}
+
+// applyMove is ApplyMove without the validation, returns the record to undo it.
+// This is the only place where the turn is switched after a move (including the pass of the opponent).
+func (s *State) applyMove(moveIndex uint8) MoveRecord {
+	record := MoveRecord{Move: moveIndex, BlackTurn: s.BlackTurn, Hash: s.Hash}
+	if s.BlackTurn {
+		record.Flips = ResolveMove(&s.Boards.Black, &s.Boards.White, moveIndex)
 	} else {
-		ResolveMove(&b.White, &b.Black, index)
+		record.Flips = ResolveMove(&s.Boards.White, &s.Boards.Black, moveIndex)
+	}
+	s.Hash ^= zobristMoveDelta(s.BlackTurn, moveIndex, record.Flips)
+
+	s.BlackTurn = !s.BlackTurn // SWITCH TURN
+	s.Hash ^= zobristBlackTurn
+	if !s.Boards.HasValidMove(s.BlackTurn) && s.Boards.HasValidMove(!s.BlackTurn) {
+		s.BlackTurn = !s.BlackTurn
+		s.Hash ^= zobristBlackTurn
 	}
+	return record
 }
 
 // IsTerminalState returns if the current state is terminal (no moves remaining by both players).
@@ -334,3 +407,99 @@ func CurrentStateScore(state State) [2]int {
 	whiteScore := state.Boards.CountOfPieces(false)
 	return [2]int{blackScore, whiteScore}
 }
+
+// --- Error returning API ---
+// The functions above panic on invalid input because the engine only generates valid moves.
+// Input that comes from a user (GUI, terminal, servers) should go through these instead.
+
+var (
+	ErrOutOfRange = errors.New("square out of range")
+	ErrOccupied   = errors.New("square is occupied")
+	ErrNoFlips    = errors.New("move does not flip any disk")
+	ErrWrongTurn  = errors.New("not this player's turn")
+	ErrGameOver   = errors.New("game is over")
+)
+
+// checkCoordinates returns ErrOutOfRange if (row, col) is not on the board.
+func checkCoordinates(row, col int) error {
+	if row < 0 || row > 7 || col < 0 || col > 7 {
+		return fmt.Errorf("%w: row %d col %d", ErrOutOfRange, row, col)
+	}
+	return nil
+}
+
+// TryCellState returns the state of the cell at (row, col) or an error if it is out of range.
+func (b *Board) TryCellState(row, col int) (CellState, error) {
+	if err := checkCoordinates(row, col); err != nil {
+		return CELL_EMPTY, err
+	}
+	return b.CellState(row, col), nil
+}
+
+// TrySetCellState sets a cell to black, white, or empty, or returns an error if it is out of range.
+func (b *Board) TrySetCellState(row, col int, state CellState) error {
+	if err := checkCoordinates(row, col); err != nil {
+		return err
+	}
+	b.SetCellState(row, col, state)
+	return nil
+}
+
+// checkMoveIndex returns why the move cannot be made by the player, or nil if it is valid.
+func (b *Board) checkMoveIndex(forBlack bool, index uint8) error {
+	if index >= 64 {
+		return fmt.Errorf("%w: index %d", ErrOutOfRange, index)
+	}
+	mask := uint64(1) << index
+	if (b.Black|b.White)&mask != 0 {
+		return fmt.Errorf("%w: %s", ErrOccupied, MoveString(index))
+	}
+	if !b.IsValidMoveIndex(forBlack, index) {
+		return fmt.Errorf("%w: %s", ErrNoFlips, MoveString(index))
+	}
+	return nil
+}
+
+// TryMoveIndex executes the move given a position index, or returns an error if it is not valid.
+// The board is not modified when there is an error.
+func (b *Board) TryMoveIndex(forBlack bool, index uint8) error {
+	if err := b.checkMoveIndex(forBlack, index); err != nil {
+		return err
+	}
+	if forBlack {
+		ResolveMove(&b.Black, &b.White, index)
+	} else {
+		ResolveMove(&b.White, &b.Black, index)
+	}
+	return nil
+}
+
+// TryMovePositional executes the move given a position (in row col format), or returns an error if it is not valid.
+func (b *Board) TryMovePositional(forBlack bool, row, col uint8) error {
+	if err := checkCoordinates(int(row), int(col)); err != nil {
+		return err
+	}
+	return b.TryMoveIndex(forBlack, row*8+col)
+}
+
+// TryMove makes the move for the given player like ApplyMove does, or returns an error if it cannot be made:
+// the game is over, it is not the turn of the player or the move is not valid on the board.
+// The state is not modified when there is an error.
+func (s *State) TryMove(forBlack bool, moveIndex uint8) error {
+	if err := s.checkMove(forBlack, moveIndex); err != nil {
+		return err
+	}
+	s.applyMove(moveIndex)
+	return nil
+}
+
+// checkMove returns why the player cannot make the move in this state, or nil if it is valid.
+func (s *State) checkMove(forBlack bool, moveIndex uint8) error {
+	if IsTerminalState(*s) {
+		return ErrGameOver
+	}
+	if forBlack != s.BlackTurn {
+		return ErrWrongTurn
+	}
+	return s.Boards.checkMoveIndex(forBlack, moveIndex)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestTryMoveErrors(t *testing.T) {
+	start := InitialState()
+	over := State{Boards: Board{Black: 0xFFFFFFFF, White: 0xFFFFFFFF00000000}, BlackTurn: true}
+	over.Hash = over.Boards.ZobristHash(over.BlackTurn)
+	tests := []struct {
+		name     string
+		state    State
+		forBlack bool
+		move     uint8
+		want     error
+	}{
+		{"valid", start, true, 19, nil},                  // d3
+		{"out of range", start, true, 64, ErrOutOfRange}, // PASS_MOVE is not a square
+		{"far out of range", start, true, 200, ErrOutOfRange},
+		{"occupied", start, true, 27, ErrOccupied},                    // d4
+		{"no flips", start, true, 0, ErrNoFlips},                      // a1
+		{"next to a disk without flips", start, true, 18, ErrNoFlips}, // c3
+		{"wrong turn", start, false, 19, ErrWrongTurn},
+		{"game over", over, true, 0, ErrGameOver},
+	}
+	for _, test := range tests {
+		state := test.state
+		err := state.TryMove(test.forBlack, test.move)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: TryMove = %v, want %v", test.name, err, test.want)
+		}
+		if err != nil && state != test.state {
+			t.Errorf("%s: TryMove modified the state after %v", test.name, err)
+		}
+		state = test.state
+		if _, err := state.MakeMove(test.move); test.forBlack && !errors.Is(err, test.want) {
+			t.Errorf("%s: MakeMove = %v, want %v", test.name, err, test.want)
+		}
+		if test.want == ErrWrongTurn || test.want == ErrGameOver {
+			continue // The board does not know the turn or the end of the game
+		}
+		board := test.state.Boards
+		err = board.TryMoveIndex(test.forBlack, test.move)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: TryMoveIndex = %v, want %v", test.name, err, test.want)
+		}
+		if err != nil && board != test.state.Boards {
+			t.Errorf("%s: TryMoveIndex modified the board after %v", test.name, err)
+		}
+	}
+}
+
+func TestTryMovePositionalErrors(t *testing.T) {
+	for _, test := range []struct {
+		row, col uint8
+		want     error
+	}{{2, 3, nil}, {8, 0, ErrOutOfRange}, {0, 8, ErrOutOfRange}, {255, 255, ErrOutOfRange}, {3, 3, ErrOccupied}, {7, 7, ErrNoFlips}} {
+		board := InitialState().Boards
+		if err := board.TryMovePositional(true, test.row, test.col); !errors.Is(err, test.want) {
+			t.Errorf("row %d col %d: %v, want %v", test.row, test.col, err, test.want)
+		}
+	}
+}
+
+func TestMakeUnmakeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	passes := 0
+	for game := 0; game < 200; game++ {
+		state := InitialState()
+		var history []State
+		var records []MoveRecord
+		for !IsTerminalState(state) {
+			moves := FastArrayOfMoves(legalMovesOf(state))
+			move := moves[rng.Intn(len(moves))]
+			my, opp := state.Boards.White, state.Boards.Black
+			if state.BlackTurn {
+				my, opp = opp, my
+			}
+			flips := Flips(my, opp, move)
+
+			// The bitboard level first
+			newMy, newOpp := my, opp
+			if captured := ResolveMove(&newMy, &newOpp, move); captured != flips {
+				t.Fatalf("%s: ResolveMove of %s captured %#x, Flips says %#x", state.PositionString(), MoveString(move), captured, flips)
+			}
+			UnresolveMove(&newMy, &newOpp, move, flips)
+			if newMy != my || newOpp != opp {
+				t.Fatalf("%s: UnresolveMove of %s did not restore the bitboards", state.PositionString(), MoveString(move))
+			}
+
+			history = append(history, state)
+			record, err := state.MakeMove(move)
+			if err != nil {
+				t.Fatalf("%s: MakeMove of the legal move %s: %v", history[len(history)-1].PositionString(), MoveString(move), err)
+			}
+			if record.Flips != flips {
+				t.Fatalf("%s: the record of %s has flips %#x, want %#x", history[len(history)-1].PositionString(), MoveString(move), record.Flips, flips)
+			}
+			if state.BlackTurn == record.BlackTurn && !IsTerminalState(state) {
+				passes++ // The opponent had to pass, Unmake must give the turn back
+			}
+			records = append(records, record)
+		}
+		for i := len(records) - 1; i >= 0; i-- {
+			state.Unmake(records[i])
+			if state != history[i] {
+				t.Fatalf("unmake of move %d %s: %s turn %v hash %#x, want %s turn %v hash %#x", i, MoveString(records[i].Move),
+					state.PositionString(), state.BlackTurn, state.Hash, history[i].PositionString(), history[i].BlackTurn, history[i].Hash)
+			}
+		}
+	}
+	if passes == 0 {
+		t.Error("no game had a pass, unmaking a pass was not checked")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import "math/bits"
+
+// The Othello board has the 8 symmetries of the square (the dihedral group): 4 rotations and 4 reflections.
+// Positions that are a symmetry of each other have the same value, and so do their moves once transformed.
+
+// Symmetry identifies one of the 8 transformations of the board.
+type Symmetry int
+
+const (
+	IDENTITY           Symmetry = iota
+	ROTATE_90                   // Clockwise
+	ROTATE_180                  // Half turn
+	ROTATE_270                  // Clockwise (90 counterclockwise)
+	FLIP_VERTICAL               // Row 1 <-> row 8
+	FLIP_HORIZONTAL             // Column a <-> column h
+	FLIP_DIAGONAL               // Along the a1-h8 diagonal
+	FLIP_ANTI_DIAGONAL          // Along the h1-a8 diagonal
+)
+
+// NUM_SYMMETRIES is the number of symmetries of the board.
+const NUM_SYMMETRIES = 8
+
+// flipVertical swaps the rows of the bitboard (row 0 <-> row 7).
+func flipVertical(x uint64) uint64 {
+	return bits.ReverseBytes64(x)
+}
+
+// flipHorizontal swaps the columns of the bitboard (col 0 <-> col 7).
+func flipHorizontal(x uint64) uint64 {
+	const k1 = 0x5555555555555555
+	const k2 = 0x3333333333333333
+	const k4 = 0x0F0F0F0F0F0F0F0F
+	x = ((x >> 1) & k1) | ((x & k1) << 1)
+	x = ((x >> 2) & k2) | ((x & k2) << 2)
+	x = ((x >> 4) & k4) | ((x & k4) << 4)
+	return x
+}
+
+// flipDiagonal transposes the bitboard, (row, col) <-> (col, row).
+func flipDiagonal(x uint64) uint64 {
+	const k1 = 0x5500550055005500
+	const k2 = 0x3333000033330000
+	const k4 = 0x0F0F0F0F00000000
+	t := k4 & (x ^ (x << 28))
+	x ^= t ^ (t >> 28)
+	t = k2 & (x ^ (x << 14))
+	x ^= t ^ (t >> 14)
+	t = k1 & (x ^ (x << 7))
+	x ^= t ^ (t >> 7)
+	return x
+}
+
+// flipAntiDiagonal transposes the bitboard along the other diagonal, (row, col) <-> (7-col, 7-row).
+func flipAntiDiagonal(x uint64) uint64 {
+	const k1 = 0xAA00AA00AA00AA00
+	const k2 = 0xCCCC0000CCCC0000
+	const k4 = 0xF0F0F0F00F0F0F0F
+	t := x ^ (x << 36)
+	x ^= k4 & (t ^ (x >> 36))
+	t = k2 & (x ^ (x << 18))
+	x ^= t ^ (t >> 18)
+	t = k1 & (x ^ (x << 9))
+	x ^= t ^ (t >> 9)
+	return x
+}
+
+// transformBitboard applies the symmetry to a single bitboard.
+func transformBitboard(x uint64, sym Symmetry) uint64 {
+	switch sym {
+	case ROTATE_90:
+		return flipHorizontal(flipDiagonal(x))
+	case ROTATE_180:
+		return flipVertical(flipHorizontal(x))
+	case ROTATE_270:
+		return flipVertical(flipDiagonal(x))
+	case FLIP_VERTICAL:
+		return flipVertical(x)
+	case FLIP_HORIZONTAL:
+		return flipHorizontal(x)
+	case FLIP_DIAGONAL:
+		return flipDiagonal(x)
+	case FLIP_ANTI_DIAGONAL:
+		return flipAntiDiagonal(x)
+	default:
+		return x
+	}
+}
+
+// Transform returns the board after applying the symmetry.
+func (b *Board) Transform(sym Symmetry) Board {
+	return Board{
+		Black: transformBitboard(b.Black, sym),
+		White: transformBitboard(b.White, sym),
+	}
+}
+
+// TransformMove maps a move index through the symmetry, so that it is the same move on the transformed board.
+// PASS_MOVE is not a square so it stays the same.
+func TransformMove(move uint8, sym Symmetry) uint8 {
+	if move >= 64 {
+		return move
+	}
+	row := move >> 3 // Faster division by 8
+	col := move & 7  // Faster modulo 8
+	switch sym {
+	case ROTATE_90:
+		row, col = col, 7-row
+	case ROTATE_180:
+		row, col = 7-row, 7-col
+	case ROTATE_270:
+		row, col = 7-col, row
+	case FLIP_VERTICAL:
+		row = 7 - row
+	case FLIP_HORIZONTAL:
+		col = 7 - col
+	case FLIP_DIAGONAL:
+		row, col = col, row
+	case FLIP_ANTI_DIAGONAL:
+		row, col = 7-col, 7-row
+	}
+	return row*8 + col
+}
+
+// Inverse returns the symmetry that undoes this one.
+func (sym Symmetry) Inverse() Symmetry {
+	switch sym {
+	case ROTATE_90:
+		return ROTATE_270
+	case ROTATE_270:
+		return ROTATE_90
+	default:
+		return sym // The rest are their own inverse
+	}
+}
+
+// Canonical returns the canonical form of the board, the smallest of its 8 symmetries
+// (comparing Black first and then White), and the symmetry that produces it.
+// Two boards are the same up to symmetry if and only if they have the same canonical form.
+func (b *Board) Canonical() (Board, Symmetry) {
+	best := *b
+	bestSym := IDENTITY
+	for sym := ROTATE_90; sym < NUM_SYMMETRIES; sym++ {
+		candidate := b.Transform(sym)
+		if candidate.Black < best.Black || (candidate.Black == best.Black && candidate.White < best.White) {
+			best = candidate
+			bestSym = sym
+		}
+	}
+	return best, bestSym
+}
+
+// CanonicalState returns the state with its board in canonical form (and the hash of that board)
+// together with the symmetry used. Moves of the original state can be mapped with TransformMove.
+func CanonicalState(state State) (State, Symmetry) {
+	board, sym := state.Boards.Canonical()
+	canonical := State{
+		Boards:    board,
+		BlackTurn: state.BlackTurn,
+		Hash:      board.ZobristHash(state.BlackTurn),
+	}
+	return canonical, sym
+}
+
+// invariantSymmetries returns the symmetries other than IDENTITY that leave the board unchanged,
+// they are the first count of invariant.
+func (b *Board) invariantSymmetries() (invariant [NUM_SYMMETRIES]Symmetry, count int) {
+	for sym := ROTATE_90; sym < NUM_SYMMETRIES; sym++ {
+		if b.Transform(sym) == *b {
+			invariant[count] = sym
+			count++
+		}
+	}
+	return invariant, count
+}
+
+// UniqueMoves removes from the moves the ones that are symmetric to another one in the list.
+// It only happens when the board is symmetric itself (like the starting position), in that case the
+// resulting positions are the same game and it is a waste to search all of them.
+// The move with the smallest index of every group is kept, the order is preserved.
+func (b *Board) UniqueMoves(moves []uint8) []uint8 {
+	invariant, count := b.invariantSymmetries()
+	if count == 0 {
+		return moves // Most positions, nothing to remove
+	}
+	var moveSet uint64
+	for _, move := range moves {
+		moveSet |= uint64(1) << move
+	}
+	unique := moves[:0]
+	for _, move := range moves {
+		duplicate := false
+		for _, sym := range invariant[:count] {
+			other := TransformMove(move, sym)
+			if other < move && moveSet&(uint64(1)<<other) != 0 {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, move)
+		}
+	}
+	return unique
+}
+
+// SYMMETRY_MAX_DISCS is the number of discs up to which the trees remove the symmetric moves.
+// Symmetric positions basically only occur in the first moves, after them checking the 7 transforms
+// of every new node is wasted.
+const SYMMETRY_MAX_DISCS = 12
+
+// treeMoves returns the legal moves that a new node of the trees searches, without the symmetric
+// ones (see UniqueMoves) while the board has at most SYMMETRY_MAX_DISCS discs.
+func (b *Board) treeMoves(legalMoves uint64) []uint8 {
+	moves := FastArrayOfMoves(legalMoves)
+	if bits.OnesCount64(b.Black|b.White) > SYMMETRY_MAX_DISCS {
+		return moves
+	}
+	return b.UniqueMoves(moves)
+}
+
+// SymmetricMoves returns the move followed by the other moves that are the same game on this board
+// (the ones that the trees remove in favor of it), in order. The searches only keep one move of
+// every group, so the analyses use this to report the result of the move for all the moves of its group.
+// Past SYMMETRY_MAX_DISCS the trees keep every move, so it is the move alone.
+func (b *Board) SymmetricMoves(move uint8) []uint8 {
+	if bits.OnesCount64(b.Black|b.White) > SYMMETRY_MAX_DISCS {
+		return []uint8{move}
+	}
+	invariant, count := b.invariantSymmetries()
+	var others uint64
+	for _, sym := range invariant[:count] {
+		if other := TransformMove(move, sym); other != move {
+			others |= uint64(1) << other
+		}
+	}
+	return append([]uint8{move}, FastArrayOfMoves(others)...)
+}
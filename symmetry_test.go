@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// transformMoves maps every move of the bitboard through the symmetry.
+func transformMoves(moves uint64, sym Symmetry) uint64 {
+	var transformed uint64
+	for _, move := range FastArrayOfMoves(moves) {
+		transformed |= uint64(1) << TransformMove(move, sym)
+	}
+	return transformed
+}
+
+func TestSymmetryRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for sym := IDENTITY; sym < NUM_SYMMETRIES; sym++ {
+		for i := 0; i < 1000; i++ {
+			black, white := randomDisjointBoards(rng)
+			board := Board{Black: black, White: white}
+			transformed := board.Transform(sym)
+			if back := transformed.Transform(sym.Inverse()); back != board {
+				t.Fatalf("symmetry %d: %+v comes back as %+v", sym, board, back)
+			}
+		}
+		for move := uint8(0); move <= PASS_MOVE; move++ {
+			if back := TransformMove(TransformMove(move, sym), sym.Inverse()); back != move {
+				t.Errorf("symmetry %d: move %d comes back as %d", sym, move, back)
+			}
+		}
+	}
+}
+
+func TestSymmetryMovesAgreeWithBitboards(t *testing.T) {
+	for sym := IDENTITY; sym < NUM_SYMMETRIES; sym++ {
+		for move := uint8(0); move < 64; move++ {
+			if got, want := transformBitboard(uint64(1)<<move, sym), uint64(1)<<TransformMove(move, sym); got != want {
+				t.Errorf("symmetry %d: square %s goes to %#x, the move to %#x", sym, MoveString(move), got, want)
+			}
+		}
+	}
+}
+
+func TestSymmetryComposition(t *testing.T) {
+	// The symmetries are a group: composing two of them gives another one, and its inverse composes to the identity
+	for a := IDENTITY; a < NUM_SYMMETRIES; a++ {
+		if got := TransformMove(TransformMove(1, a), a.Inverse()); got != 1 {
+			t.Errorf("symmetry %d composed with its inverse moves b1 to %s", a, MoveString(got))
+		}
+		for b := IDENTITY; b < NUM_SYMMETRIES; b++ {
+			composed := -1
+			for c := IDENTITY; c < NUM_SYMMETRIES; c++ {
+				same := true
+				for move := uint8(0); move < 64 && same; move++ {
+					same = TransformMove(TransformMove(move, a), b) == TransformMove(move, c)
+				}
+				if same {
+					composed = int(c)
+					break
+				}
+			}
+			if composed < 0 {
+				t.Errorf("symmetry %d followed by %d is not a symmetry", a, b)
+			}
+		}
+	}
+}
+
+func TestCanonicalIsInvariant(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		black, white := randomDisjointBoards(rng)
+		board := Board{Black: black, White: white}
+		canonical, sym := board.Canonical()
+		if board.Transform(sym) != canonical {
+			t.Fatalf("%+v: the symmetry %d does not produce the canonical form", board, sym)
+		}
+		for s := IDENTITY; s < NUM_SYMMETRIES; s++ {
+			transformed := board.Transform(s)
+			if other, _ := transformed.Canonical(); other != canonical {
+				t.Fatalf("%+v: symmetry %d has canonical form %+v, want %+v", board, s, other, canonical)
+			}
+		}
+	}
+}
+
+func TestSymmetryMapsLegalMoves(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 200; i++ {
+		state := randomPositionWithEmpties(10+rng.Intn(50), rng)
+		moves := legalMovesOf(state)
+		for sym := IDENTITY; sym < NUM_SYMMETRIES; sym++ {
+			transformed := state
+			transformed.Boards = state.Boards.Transform(sym)
+			if got, want := legalMovesOf(transformed), transformMoves(moves, sym); got != want {
+				t.Fatalf("%s symmetry %d: legal moves %#x, want %#x", state.PositionString(), sym, got, want)
+			}
+			for _, move := range FastArrayOfMoves(moves) {
+				after := state.Boards
+				after.MakeMoveIndex(state.BlackTurn, move)
+				transformedAfter := transformed.Boards
+				transformedAfter.MakeMoveIndex(state.BlackTurn, TransformMove(move, sym))
+				if after.Transform(sym) != transformedAfter {
+					t.Fatalf("%s symmetry %d: move %s does not commute with the symmetry", state.PositionString(), sym, MoveString(move))
+				}
+			}
+		}
+	}
+}
+
+func TestUniqueMoves(t *testing.T) {
+	state := InitialState()
+	moves := FastArrayOfMoves(legalMovesOf(state))
+	if unique := state.Boards.UniqueMoves(moves); len(unique) != 1 || unique[0] != 19 {
+		t.Errorf("unique opening moves %v, want [d3]", unique)
+	}
+	state.ApplyMove(19) // d3, the board is not symmetric anymore
+	moves = FastArrayOfMoves(legalMovesOf(state))
+	if unique := state.Boards.UniqueMoves(append([]uint8(nil), moves...)); len(unique) != len(moves) {
+		t.Errorf("unique moves after d3 %v, want all of %v", unique, moves)
+	}
+}
+
+func TestSymmetricMoves(t *testing.T) {
+	state := InitialState()
+	if got := state.Boards.SymmetricMoves(19); len(got) != 4 || got[0] != 19 {
+		t.Errorf("symmetric moves of d3 %v, want d3 and the other 3 opening moves", got)
+	}
+	var all uint64
+	for _, move := range state.Boards.SymmetricMoves(19) {
+		all |= uint64(1) << move
+	}
+	if all != legalMovesOf(state) {
+		t.Errorf("symmetric moves of d3 %#x, the opening moves are %#x", all, legalMovesOf(state))
+	}
+	state.ApplyMove(19)
+	for _, move := range FastArrayOfMoves(legalMovesOf(state)) {
+		if got := state.Boards.SymmetricMoves(move); len(got) != 1 || got[0] != move {
+			t.Errorf("symmetric moves of %s on an asymmetric board %v", MoveString(move), got)
+		}
+	}
+}
+
+func TestTreeMovesOnlyRemovesSymmetricMovesInTheOpening(t *testing.T) {
+	state := InitialState()
+	if moves := state.Boards.treeMoves(legalMovesOf(state)); len(moves) != 1 {
+		t.Errorf("tree moves of the opening %v, want one", moves)
+	}
+	// Symmetric up to a half turn and both flips, but with too many discs to check it
+	state.Boards = Board{Black: 0xFFFF00000000FFFF, White: 0x0000FF0000FF0000}
+	legal := legalMovesOf(state)
+	if moves := state.Boards.treeMoves(legal); len(moves) != bits.OnesCount64(legal) {
+		t.Errorf("tree moves %v, want all the %d legal moves", moves, bits.OnesCount64(legal))
+	}
+	if unique := state.Boards.UniqueMoves(FastArrayOfMoves(legal)); len(unique) == bits.OnesCount64(legal) {
+		t.Errorf("unique moves %v of a symmetric board, want fewer than the legal moves", unique)
+	}
+	if got := NewNode(state, nil, PASS_MOVE).UntriedMoves; len(got) != bits.OnesCount64(legal) {
+		t.Errorf("untried moves %v, want all the legal moves", got)
+	}
+}
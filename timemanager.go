@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Time management for games on a clock. The GameClock keeps the time of both players and the TimeManager
+// decides how much of it every move gets:
+//
+//   - The time left is split between the moves the player still has to search, counted from the empty
+//     squares, plus most of the increment. This is the soft limit of the move. The solver plays the last
+//     EndgameEmpties squares, so those moves are not counted but SolverReserve is kept for them.
+//     A solve is charged to the clock like a search: it gets half of the hard limit of its move, and if it
+//     does not finish the move is searched with the time that is left.
+//   - The hard limit is a few times the soft limit, never more than a share of the time left.
+//   - The search runs in chunks. After the soft limit it stops once the best move has been the same
+//     for StableChunks chunks, an unstable best move keeps searching up to the hard limit. A clear
+//     favourite (twice the visits of the second move) stops at half the soft limit.
+//   - At any time, if the second move cannot reach the visits of the best with the playouts that fit
+//     before the hard limit, the search stops: the best move cannot be overtaken.
+
+// ErrOutOfTime is returned when a player runs out of time.
+var ErrOutOfTime = errors.New("out of time")
+
+// TIME_MANAGER_CHUNK is the number of iterations (per routine) of every chunk of a managed search.
+const TIME_MANAGER_CHUNK = 200
+
+// GameClock is the clock of a game: the time left of each player and the increment after every move.
+type GameClock struct {
+	Left      [2]time.Duration // Position 0 is black, position 1 is white
+	Increment time.Duration
+}
+
+// NewGameClock returns a clock where both players have total time plus increment after every move.
+func NewGameClock(total, increment time.Duration) *GameClock {
+	return &GameClock{Left: [2]time.Duration{total, total}, Increment: increment}
+}
+
+// Spend subtracts the time of a move from its player and adds the increment.
+// Returns ErrOutOfTime if the player ran out of time during the move.
+func (c *GameClock) Spend(black bool, used time.Duration) error {
+	player := 1
+	if black {
+		player = 0
+	}
+	c.Left[player] -= used
+	if c.Left[player] < 0 {
+		return ErrOutOfTime
+	}
+	c.Left[player] += c.Increment
+	return nil
+}
+
+// TimeLeft returns the time left of a player.
+func (c *GameClock) TimeLeft(black bool) time.Duration {
+	if black {
+		return c.Left[0]
+	}
+	return c.Left[1]
+}
+
+// TimeManager decides the time of every move from the time left, see the description above.
+type TimeManager struct {
+	Overhead      time.Duration // Kept from every move for the communication and the moves of the tree
+	SolverReserve time.Duration // Kept until the solver takes over, for the exact endgame search
+	HardFactor    float64       // The hard limit is the soft limit times this
+	MaxShare      float64       // Share of the time left that a move can take at most
+	StableChunks  int           // Chunks the best move must stay the same to stop after the soft limit
+}
+
+// NewTimeManager returns a time manager with the default settings.
+func NewTimeManager() *TimeManager {
+	return &TimeManager{
+		Overhead:      20 * time.Millisecond,
+		SolverReserve: 2 * time.Second,
+		HardFactor:    3,
+		MaxShare:      0.3,
+		StableChunks:  3,
+	}
+}
+
+// Allocate returns the soft and hard limits of the next move of a player with the time left,
+// the increment after the move and the empty squares of the board.
+func (tm *TimeManager) Allocate(left, increment time.Duration, empties int) (soft, hard time.Duration) {
+	movesLeft := max((empties-EndgameEmpties+1)/2, 1) // The moves searched until the solver takes over
+	available := max(left-tm.Overhead, 0)
+	if empties > EndgameEmpties {
+		available = max(available-tm.SolverReserve, 0)
+	}
+	soft = available/time.Duration(movesLeft) + increment*3/4
+	hard = min(time.Duration(float64(soft)*tm.HardFactor), time.Duration(float64(available)*tm.MaxShare)+increment*3/4)
+	if hard < soft {
+		soft = hard
+	}
+	// Always allow a minimal search, the search runs at least one playout anyway
+	return max(soft, time.Millisecond), max(hard, time.Millisecond)
+}
+
+// searchChunk runs one chunk of a search (see Engine.BestMoveOnClock) until the limits are reached and
+// returns the playouts, the best move and the visits of the two most visited moves.
+type searchChunk func(ctx context.Context, limits Limits) (playouts int, best uint8, first, second int)
+
+// Search runs chunks of a search until the time manager stops it and returns the best move and the playouts.
+func (tm *TimeManager) Search(ctx context.Context, left, increment time.Duration, empties int, chunk searchChunk) (uint8, int) {
+	start := time.Now()
+	soft, hard := tm.Allocate(left, increment, empties)
+	ctx, cancel := context.WithDeadline(ctx, start.Add(hard))
+	defer cancel()
+
+	playouts, stable := 0, 0
+	best := PASS_MOVE
+	for {
+		n, leader, first, second := chunk(ctx, Limits{Iterations: TIME_MANAGER_CHUNK})
+		playouts += n
+		if leader == best {
+			stable++
+		} else {
+			best, stable = leader, 0
+		}
+		if ctx.Err() != nil || tm.stop(time.Since(start), soft, hard, playouts, stable, first, second) {
+			return best, playouts
+		}
+	}
+}
+
+// stop returns true if a search that took elapsed time and ran the playouts can stop.
+// stable is the number of chunks without a change of the best move.
+func (tm *TimeManager) stop(elapsed, soft, hard time.Duration, playouts, stable, first, second int) bool {
+	// The best move cannot be overtaken with the playouts left until the hard limit
+	remaining := float64(playouts) * float64(hard-elapsed) / float64(max(elapsed, time.Microsecond))
+	if float64(first-second) > remaining {
+		return true
+	}
+	limit := soft
+	if first >= 2*second {
+		limit /= 2 // Clear favourite
+	}
+	return elapsed >= limit && stable >= tm.StableChunks
+}
+
+// topVisits returns the visits of the two most visited moves.
+func topVisits(visits []int) (first, second int) {
+	for _, v := range visits {
+		if v > first {
+			first, second = v, first
+		} else if v > second {
+			second = v
+		}
+	}
+	return first, second
+}
+
+// PlayEnginesOnClock plays a game between two engines on the clock and returns its record.
+// Every engine manages its time with tm. If a player runs out of time the game stops there and
+// the error is ErrOutOfTime. Position 0 is black, position 1 is white.
+func PlayEnginesOnClock(black, white Engine, clock *GameClock, tm *TimeManager, info [2]PlayerInfo) (*GameRecord, error) {
+	engines := [2]Engine{black, white}
+	for _, engine := range engines {
+		engine.NewGame()
+	}
+	record := NewGameRecord(info[0], info[1])
+	for state := record.State(); !IsTerminalState(state); state = record.State() {
+		side := 1
+		if state.BlackTurn {
+			side = 0
+		}
+		start := time.Now()
+		move, stats := engines[side].BestMoveOnClock(context.Background(), tm, clock.TimeLeft(state.BlackTurn), clock.Increment)
+		if err := clock.Spend(state.BlackTurn, time.Since(start)); err != nil {
+			return record, err
+		}
+		record.Play(move, MoveStats{Visits: stats.Visits, Duration: stats.Duration})
+		for _, engine := range engines {
+			if err := engine.Play(move); err != nil {
+				panic(err) // The move was legal for the record, so both engines are out of sync
+			}
+		}
+	}
+	return record, nil
+}
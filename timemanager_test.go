@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestGameClock(t *testing.T) {
+	clock := NewGameClock(10*time.Second, 2*time.Second)
+	if err := clock.Spend(true, 3*time.Second); err != nil || clock.TimeLeft(true) != 9*time.Second {
+		t.Errorf("after 3s black has %s (%v)", clock.TimeLeft(true), err)
+	}
+	if clock.TimeLeft(false) != 10*time.Second {
+		t.Errorf("white has %s", clock.TimeLeft(false))
+	}
+	if err := clock.Spend(false, 11*time.Second); !errors.Is(err, ErrOutOfTime) {
+		t.Errorf("white spent 11s of 10s: %v", err)
+	}
+}
+
+func TestTimeManagerAllocate(t *testing.T) {
+	tm := NewTimeManager()
+	opening, openingHard := tm.Allocate(5*time.Minute, 0, 60)
+	midgame, _ := tm.Allocate(5*time.Minute, 0, 30)
+	if opening <= 0 || opening >= midgame || openingHard < opening {
+		t.Errorf("5 minutes: opening %s (hard %s), midgame %s", opening, openingHard, midgame)
+	}
+	if _, hard := tm.Allocate(time.Minute, 0, 22); hard > time.Duration(float64(time.Minute)*tm.MaxShare) {
+		t.Errorf("hard limit %s over the max share of 1 minute", hard)
+	}
+	withIncrement, _ := tm.Allocate(5*time.Minute, 3*time.Second, 60)
+	if withIncrement <= opening {
+		t.Errorf("the increment did not add time: %s, without %s", withIncrement, opening)
+	}
+	if soft, hard := tm.Allocate(0, 0, 40); soft <= 0 || hard < soft {
+		t.Errorf("no time left: %s %s", soft, hard)
+	}
+}
+
+func TestTimeManagerStop(t *testing.T) {
+	tm := NewTimeManager()
+	// 1000 playouts in 100ms, 100ms to the hard limit: 1000 more playouts cannot close a gap of 1100 visits
+	if !tm.stop(100*time.Millisecond, time.Second, 200*time.Millisecond, 1000, 0, 1150, 50) {
+		t.Error("did not stop when the best move cannot be overtaken")
+	}
+	if tm.stop(100*time.Millisecond, time.Second, 200*time.Millisecond, 1000, 0, 600, 400) {
+		t.Error("stopped with a close second move")
+	}
+	if tm.stop(time.Second, time.Second, 3*time.Second, 10000, 0, 5000, 4000) {
+		t.Error("stopped at the soft limit with an unstable best move")
+	}
+	if !tm.stop(time.Second, time.Second, 3*time.Second, 10000, tm.StableChunks, 5000, 4000) {
+		t.Error("did not stop at the soft limit with a stable best move")
+	}
+}
+
+func TestPlayEnginesOnClock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("plays a game on the clock")
+	}
+	// The default settings: the solves of the first endgame moves do not fit in the time left
+	tm := NewTimeManager()
+	clock := NewGameClock(3*time.Second, 0)
+	rng := rand.New(rand.NewSource(1))
+	record, err := PlayEnginesOnClock(NewEngine("puct", rng), NewEngine("puct-root-parallel", rng), clock, tm, [2]PlayerInfo{})
+	if err != nil {
+		t.Fatalf("%v, clock %v", err, clock.Left)
+	}
+	if !IsTerminalState(record.State()) {
+		t.Error("the game did not end")
+	}
+}
+
+func TestBestMoveOnClockChargesTheSolver(t *testing.T) {
+	state := randomPositionWithEmpties(EndgameEmpties, rand.New(rand.NewSource(4)))
+	for _, name := range []string{"uct", "puct"} {
+		engine := NewEngine(name, rand.New(rand.NewSource(1)))
+		engine.Reset(state)
+		start := time.Now()
+		move, _ := engine.BestMoveOnClock(context.Background(), NewTimeManager(), 200*time.Millisecond, 0)
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Errorf("%s: the move of %s took %s of 200ms", name, state.PositionString(), elapsed)
+		}
+		if legalMovesOf(state)&(uint64(1)<<move) == 0 {
+			t.Errorf("%s: played %s, not a legal move", name, MoveString(move))
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import "sync/atomic"
+
+// Transposition table: a fixed size hash table indexed by the Zobrist hash of a position.
+// The same position can be reached through different move orders, with the table the
+// searches can reuse what they already learned about it instead of starting from zero.
+
+// ttEntry is a slot of the table.
+type ttEntry[T any] struct {
+	key   uint64
+	depth int // Importance of the entry, entries with more depth are harder to replace
+	used  bool
+	value T
+}
+
+// TranspositionTable stores a value of type T per position.
+// Entries are grouped in buckets of two slots: the first one keeps the most important entry
+// (depth-preferred) and the second one is always replaced. This way old but expensive results
+// survive while recent positions still find a place.
+// Several routines can look up positions at the same time while nobody stores (the lookup counters are atomic),
+// otherwise it is not safe for concurrent use and every search should have its own.
+type TranspositionTable[T any] struct {
+	entries      []ttEntry[T]
+	mask         uint64
+	Probes       atomic.Int64 // Number of lookups
+	Hits         atomic.Int64 // Number of lookups that found the position
+	Stores       int          // Number of stores
+	Replacements int          // Number of stores that removed a different position
+}
+
+// NewTranspositionTable returns a table with room for at least 2 and at most size entries.
+// The size is rounded down to a power of 2 so the index can be computed with a mask.
+func NewTranspositionTable[T any](size int) *TranspositionTable[T] {
+	buckets := 1
+	for buckets*4 <= size {
+		buckets *= 2
+	}
+	return &TranspositionTable[T]{
+		entries: make([]ttEntry[T], buckets*2),
+		mask:    uint64(buckets - 1),
+	}
+}
+
+// bucket returns the index of the first slot of the bucket of the key.
+func (t *TranspositionTable[T]) bucket(key uint64) int {
+	return int(key&t.mask) * 2
+}
+
+// find returns the entry of the key or nil if it is not in the table (without counting it as a probe).
+func (t *TranspositionTable[T]) find(key uint64) *ttEntry[T] {
+	i := t.bucket(key)
+	for j := i; j < i+2; j++ {
+		if t.entries[j].used && t.entries[j].key == key {
+			return &t.entries[j]
+		}
+	}
+	return nil
+}
+
+// Lookup returns the value stored for the key and true, or the zero value and false if it is not present.
+func (t *TranspositionTable[T]) Lookup(key uint64) (T, bool) {
+	t.Probes.Add(1)
+	if entry := t.find(key); entry != nil {
+		t.Hits.Add(1)
+		return entry.value, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Store saves the value of the key, depth is the importance of the entry for the replacement policy.
+func (t *TranspositionTable[T]) Store(key uint64, depth int, value T) {
+	t.Stores++
+	entry := t.find(key)
+	if entry == nil {
+		i := t.bucket(key)
+		preferred := &t.entries[i]
+		if !preferred.used || depth >= preferred.depth {
+			entry = preferred
+		} else {
+			entry = &t.entries[i+1] // Always replace slot
+		}
+		if entry.used {
+			t.Replacements++
+		}
+	}
+	entry.key = key
+	entry.depth = depth
+	entry.used = true
+	entry.value = value
+}
+
+// HitRate returns the fraction of lookups that found their position.
+func (t *TranspositionTable[T]) HitRate() float64 {
+	probes := t.Probes.Load()
+	if probes == 0 {
+		return 0
+	}
+	return float64(t.Hits.Load()) / float64(probes)
+}
+
+// Clear removes every entry and resets the statistics.
+func (t *TranspositionTable[T]) Clear() {
+	clear(t.entries)
+	t.Probes.Store(0)
+	t.Hits.Store(0)
+	t.Stores, t.Replacements = 0, 0
+}
+
+// MCTSStats are the results of the simulations that went through a position.
+// They are kept by color because the same position can be reached by a move of either player
+// (when the opponent has to pass).
+type MCTSStats struct {
+	Visits    int
+	BlackWins int
+	WhiteWins int
+	Draws     int
+}
+
+// MCTSTable is the transposition table shared by the nodes of a MCTS tree (Node or PUCTNode).
+// It is opt-in: the engines only have one with ENGINE_TABLE_SUFFIX (like puct-tt), otherwise set the Table
+// of the root before searching and the children inherit it. The shared tree search (TreeParallelizationMCTSPUCT) only looks up positions in it, it never stores.
+type MCTSTable = TranspositionTable[MCTSStats]
+
+// DEFAULT_MCTS_TABLE_SIZE is a reasonable size for a MCTSTable (around 28 MB).
+const DEFAULT_MCTS_TABLE_SIZE = 1 << 19
+
+// NewMCTSTable returns a transposition table for the statistics of MCTS trees.
+func NewMCTSTable(size int) *MCTSTable {
+	return NewTranspositionTable[MCTSStats](size)
+}
+
+// WinsFor returns the wins from the point of view of the given player (A tie also counts as a win).
+// This is the same convention used by OriginalBackpropagate.
+func (stats MCTSStats) WinsFor(forBlack bool) int {
+	if forBlack {
+		return stats.BlackWins + stats.Draws
+	}
+	return stats.WhiteWins + stats.Draws
+}
+
+// RewardFor returns the average reward from the point of view of the given player (A tie counts as 0.5).
+// This is the same convention used by BackpropagatePUCT.
+func (stats MCTSStats) RewardFor(forBlack bool) float64 {
+	if stats.Visits == 0 {
+		return 0
+	}
+	wins := stats.WhiteWins
+	if forBlack {
+		wins = stats.BlackWins
+	}
+	return (float64(wins) + 0.5*float64(stats.Draws)) / float64(stats.Visits)
+}
+
+// seedVisits returns the visits that a new child starts with from the statistics of its position: the visits
+// of the table, but no more than the visits of the parent that its other children do not have. UCT and PUCT
+// assume that the children of a node have at most its visits together.
+func seedVisits(stats MCTSStats, parentVisits, childrenVisits int) int {
+	return max(min(stats.Visits, parentVisits-childrenVisits), 0)
+}
+
+// recordResult adds the result of a simulation to the statistics of the position.
+func recordResult(table *MCTSTable, hash uint64, result WinState) {
+	var stats MCTSStats
+	if entry := table.find(hash); entry != nil {
+		stats = entry.value
+	}
+	stats.Visits++
+	switch result {
+	case BLACK_WIN:
+		stats.BlackWins++
+	case WHITE_WIN:
+		stats.WhiteWins++
+	case DRAW:
+		stats.Draws++
+	}
+	table.Store(hash, stats.Visits, stats)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestTranspositionTableLookupStore(t *testing.T) {
+	table := NewTranspositionTable[int](16)
+	if _, found := table.Lookup(42); found {
+		t.Fatal("found a key in an empty table")
+	}
+	table.Store(42, 1, 7)
+	if value, found := table.Lookup(42); !found || value != 7 {
+		t.Fatalf("lookup after store: %d %v, want 7 true", value, found)
+	}
+	table.Store(42, 0, 8) // Same position, updated in place whatever the depth
+	if value, _ := table.Lookup(42); value != 8 {
+		t.Errorf("lookup after update: %d, want 8", value)
+	}
+	if table.Probes.Load() != 3 || table.Hits.Load() != 2 || table.Stores != 2 || table.Replacements != 0 {
+		t.Errorf("probes %d hits %d stores %d replacements %d, want 3 2 2 0", table.Probes.Load(), table.Hits.Load(), table.Stores, table.Replacements)
+	}
+	if rate := table.HitRate(); rate != 2.0/3.0 {
+		t.Errorf("hit rate %v, want 2/3", rate)
+	}
+	table.Clear()
+	if _, found := table.Lookup(42); found || table.Probes.Load() != 1 || table.Stores != 0 {
+		t.Errorf("after clear: found %v probes %d stores %d", found, table.Probes.Load(), table.Stores)
+	}
+}
+
+func TestTranspositionTableSize(t *testing.T) {
+	for _, test := range []struct{ size, entries int }{{0, 2}, {1, 2}, {3, 2}, {4, 4}, {7, 4}, {8, 8}, {1000, 512}} {
+		if got := len(NewTranspositionTable[int](test.size).entries); got != test.entries {
+			t.Errorf("size %d: %d entries, want %d", test.size, got, test.entries)
+		}
+	}
+}
+
+func TestTranspositionTableReplacement(t *testing.T) {
+	table := NewTranspositionTable[int](4) // Two buckets, the even keys share the first one
+	table.Store(0, 5, 0)                   // Preferred slot
+	table.Store(2, 3, 2)                   // Less depth, goes to the always replace slot
+	table.Store(4, 1, 4)                   // Replaces 2 in the always replace slot
+	for key, want := range map[uint64]bool{0: true, 2: false, 4: true} {
+		if _, found := table.Lookup(key); found != want {
+			t.Errorf("key %d found %v, want %v", key, found, want)
+		}
+	}
+	table.Store(6, 5, 6) // Same depth, replaces 0 in the preferred slot
+	for key, want := range map[uint64]bool{0: false, 4: true, 6: true} {
+		if _, found := table.Lookup(key); found != want {
+			t.Errorf("key %d found %v, want %v", key, found, want)
+		}
+	}
+	table.Store(1, 0, 1) // The other bucket is still empty
+	if table.Replacements != 2 {
+		t.Errorf("%d replacements, want 2", table.Replacements)
+	}
+}
+
+func TestMCTSTableRecordsTheTree(t *testing.T) {
+	root := InitialRootNode()
+	root.Table = NewMCTSTable(DEFAULT_MCTS_TABLE_SIZE)
+	OriginalMonteCarloTreeSearch(root, 2000, rand.New(rand.NewSource(1)))
+	for _, child := range root.Children {
+		stats, found := root.Table.Lookup(child.GameState.Hash)
+		if !found || stats.Visits < child.Visits {
+			t.Errorf("child %d: table visits %d (found %v), the child has %d", child.Move, stats.Visits, found, child.Visits)
+		}
+		if stats.BlackWins+stats.WhiteWins+stats.Draws != stats.Visits {
+			t.Errorf("child %d: results do not add up to the visits %+v", child.Move, stats)
+		}
+	}
+}
+
+// checkChildrenVisits fails if the children of a node of the tree have more visits together than the node.
+func checkChildrenVisits(t *testing.T, node *Node) {
+	t.Helper()
+	visits := 0
+	for _, child := range node.Children {
+		visits += child.Visits
+		if child.Wins > child.Visits {
+			t.Fatalf("child %d has %d wins in %d visits", child.Move, child.Wins, child.Visits)
+		}
+		checkChildrenVisits(t, child)
+	}
+	if visits > node.Visits {
+		t.Fatalf("the children have %d visits, the node %d", visits, node.Visits)
+	}
+}
+
+// checkChildrenVisitsPUCT is checkChildrenVisits for PUCTNode trees.
+func checkChildrenVisitsPUCT(t *testing.T, node *PUCTNode) {
+	t.Helper()
+	visits := 0
+	for _, child := range node.Children {
+		visits += node.N[child.Move]
+		checkChildrenVisitsPUCT(t, child)
+	}
+	if visits > node.Visits {
+		t.Fatalf("the children have %d visits, the node %d", visits, node.Visits)
+	}
+}
+
+func TestMCTSTableSeedsWithinTheParentVisits(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	table := NewMCTSTable(DEFAULT_MCTS_TABLE_SIZE)
+	for i := 0; i < 2; i++ { // The second tree is seeded from the first one
+		root := InitialRootNode()
+		root.Table = table
+		OriginalMonteCarloTreeSearch(root, 2000, rng)
+		checkChildrenVisits(t, root)
+	}
+
+	table = NewMCTSTable(DEFAULT_MCTS_TABLE_SIZE)
+	for i := 0; i < 2; i++ {
+		root := InitialRootPUCTNode()
+		root.Table = table
+		MonteCarloTreeSearchPUCT(root, 2000, rng)
+		checkChildrenVisitsPUCT(t, root)
+	}
+}
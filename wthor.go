@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// WTHOR is the binary format of the database of expert games of the French Othello federation.
+// A .wtb file has a 16 bytes header followed by 68 bytes per game:
+//
+//	tournament (2 bytes), black player (2), white player (2), black discs at the end (1),
+//	theoretical black discs (1), 60 moves (1 byte each, 10*row + column from 11 = a1 to 88 = h8, 0 after the end)
+//
+// Passes are not written. The players and tournaments numbers are indexes in the .jou (20 bytes per name)
+// and .trn (26 bytes per name) files, which have the same header. All numbers are little endian.
+
+// ErrInvalidWthor is returned when a WTHOR file cannot be read.
+var ErrInvalidWthor = errors.New("invalid WTHOR file")
+
+// Sizes of the parts of WTHOR files.
+const (
+	WTHOR_HEADER_SIZE     = 16
+	WTHOR_GAME_SIZE       = 68
+	WTHOR_PLAYER_SIZE     = 20
+	WTHOR_TOURNAMENT_SIZE = 26
+)
+
+// WthorHeader is the header of a WTHOR file.
+type WthorHeader struct {
+	Created   [3]int // Year, month and day the file was created
+	Games     int    // Number of games (in .wtb files)
+	Records   int    // Number of names (in .jou and .trn files)
+	Year      int    // Year of the games
+	BoardSize int    // 8 (0 also means 8)
+	GameType  int    // 0 normal games, 1 solitaires
+	Depth     int    // Empties from which the theoretical score is perfect play
+}
+
+// WthorGame is a game of a .wtb file.
+type WthorGame struct {
+	Tournament       int
+	BlackPlayer      int
+	WhitePlayer      int
+	BlackScore       int     // Black discs at the end of the game
+	TheoreticalScore int     // Black discs with perfect play from Depth empties
+	Moves            []uint8 // Move indexes, without passes
+}
+
+// WthorReader reads the games of a .wtb file one by one.
+type WthorReader struct {
+	Header WthorHeader
+	r      io.Reader
+	read   int // Games read
+	buf    [WTHOR_GAME_SIZE]byte
+}
+
+// NewWthorReader reads the header of a .wtb file and returns a reader for its games.
+func NewWthorReader(r io.Reader) (*WthorReader, error) {
+	header, err := readWthorHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if header.BoardSize != 0 && header.BoardSize != 8 {
+		return nil, fmt.Errorf("%w: board size %d is not 8", ErrInvalidWthor, header.BoardSize)
+	}
+	if header.BoardSize == 0 {
+		header.BoardSize = 8
+	}
+	return &WthorReader{Header: header, r: r}, nil
+}
+
+// Next returns the next game, or io.EOF after the last one.
+func (wr *WthorReader) Next() (WthorGame, error) {
+	if wr.read == wr.Header.Games {
+		return WthorGame{}, io.EOF
+	}
+	if _, err := io.ReadFull(wr.r, wr.buf[:]); err != nil {
+		return WthorGame{}, fmt.Errorf("%w: game %d: %v", ErrInvalidWthor, wr.read+1, err)
+	}
+	wr.read++
+	game := WthorGame{
+		Tournament:       int(binary.LittleEndian.Uint16(wr.buf[0:2])),
+		BlackPlayer:      int(binary.LittleEndian.Uint16(wr.buf[2:4])),
+		WhitePlayer:      int(binary.LittleEndian.Uint16(wr.buf[4:6])),
+		BlackScore:       int(wr.buf[6]),
+		TheoreticalScore: int(wr.buf[7]),
+	}
+	for _, b := range wr.buf[8:] {
+		if b == 0 {
+			break
+		}
+		row, col := b/10, b%10
+		if row < 1 || row > 8 || col < 1 || col > 8 {
+			return WthorGame{}, fmt.Errorf("%w: game %d: invalid move %d", ErrInvalidWthor, wr.read, b)
+		}
+		game.Moves = append(game.Moves, (row-1)*8+col-1)
+	}
+	return game, nil
+}
+
+// States replays the game through the board rules (see ReplayGame) and returns the states after every move.
+func (g *WthorGame) States() ([]State, error) {
+	return ReplayGame(g.Moves)
+}
+
+// LoadWthor reads all the games of a .wtb file.
+func LoadWthor(path string) (WthorHeader, []WthorGame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return WthorHeader{}, nil, err
+	}
+	defer file.Close()
+	reader, err := NewWthorReader(file)
+	if err != nil {
+		return WthorHeader{}, nil, err
+	}
+	games := make([]WthorGame, 0, reader.Header.Games)
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			return reader.Header, games, nil
+		}
+		if err != nil {
+			return reader.Header, nil, err
+		}
+		games = append(games, game)
+	}
+}
+
+// ReadWthorNames reads the names of a .jou (recordSize WTHOR_PLAYER_SIZE) or .trn (WTHOR_TOURNAMENT_SIZE) file.
+// The numbers in WthorGame are indexes in the returned slice.
+func ReadWthorNames(r io.Reader, recordSize int) ([]string, error) {
+	header, err := readWthorHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, header.Records)
+	record := make([]byte, recordSize)
+	for i := range names {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, fmt.Errorf("%w: name %d: %v", ErrInvalidWthor, i+1, err)
+		}
+		names[i] = latin1String(record)
+	}
+	return names, nil
+}
+
+// LoadWthorNames reads the names of a .jou or .trn file (see ReadWthorNames).
+func LoadWthorNames(path string, recordSize int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadWthorNames(file, recordSize)
+}
+
+// readWthorHeader reads the 16 bytes header common to all WTHOR files.
+func readWthorHeader(r io.Reader) (WthorHeader, error) {
+	var buf [WTHOR_HEADER_SIZE]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return WthorHeader{}, fmt.Errorf("%w: header: %v", ErrInvalidWthor, err)
+	}
+	return WthorHeader{
+		Created:   [3]int{int(buf[0])*100 + int(buf[1]), int(buf[2]), int(buf[3])},
+		Games:     int(binary.LittleEndian.Uint32(buf[4:8])),
+		Records:   int(binary.LittleEndian.Uint16(buf[8:10])),
+		Year:      int(binary.LittleEndian.Uint16(buf[10:12])),
+		BoardSize: int(buf[12]),
+		GameType:  int(buf[13]),
+		Depth:     int(buf[14]),
+	}, nil
+}
+
+// latin1String returns the text of a zero terminated ISO-8859-1 name.
+func latin1String(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		sb.WriteRune(rune(c)) // Latin-1 characters are the first 256 runes
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// wthorHeader returns a header of a WTHOR file with the number of games or names.
+func wthorHeader(games, records int) []byte {
+	header := make([]byte, WTHOR_HEADER_SIZE)
+	header[0], header[1], header[2], header[3] = 20, 24, 5, 17
+	binary.LittleEndian.PutUint32(header[4:8], uint32(games))
+	binary.LittleEndian.PutUint16(header[8:10], uint16(records))
+	binary.LittleEndian.PutUint16(header[10:12], 2024)
+	header[14] = 22
+	return header
+}
+
+func TestWthorReader(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	records := make([]*GameRecord, 10)
+	var file bytes.Buffer
+	file.Write(wthorHeader(len(records), 0))
+	for i := range records {
+		records[i] = randomGameRecord(rng)
+		game := make([]byte, WTHOR_GAME_SIZE)
+		binary.LittleEndian.PutUint16(game[0:2], uint16(i))
+		binary.LittleEndian.PutUint16(game[2:4], uint16(2*i))
+		binary.LittleEndian.PutUint16(game[4:6], uint16(2*i+1))
+		game[6] = byte(records[i].Score[0])
+		game[7] = byte(records[i].Score[0])
+		moves := game[8:8]
+		for _, move := range records[i].Moves {
+			if move != PASS_MOVE {
+				moves = append(moves, (move/8+1)*10+move%8+1)
+			}
+		}
+		file.Write(game)
+	}
+
+	reader, err := NewWthorReader(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Header.Created != [3]int{2024, 5, 17} || reader.Header.Year != 2024 || reader.Header.Depth != 22 {
+		t.Errorf("header = %+v", reader.Header)
+	}
+	for i := range records {
+		game, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if game.Tournament != i || game.BlackPlayer != 2*i || game.WhitePlayer != 2*i+1 || game.TheoreticalScore != records[i].Score[0] {
+			t.Errorf("game %d = %+v", i+1, game)
+		}
+		states, err := game.States()
+		if err != nil {
+			t.Fatalf("game %d: %v", i+1, err)
+		}
+		if final := states[len(states)-1]; CurrentStateScore(final)[0] != game.BlackScore {
+			t.Errorf("game %d replay gives %v, want %d black discs", i+1, CurrentStateScore(final), game.BlackScore)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next after the last game error = %v, want io.EOF", err)
+	}
+
+	truncated := append(wthorHeader(1, 0), make([]byte, WTHOR_GAME_SIZE-1)...)
+	reader, err = NewWthorReader(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Next(); !errors.Is(err, ErrInvalidWthor) {
+		t.Errorf("Next of a truncated game error = %v, want ErrInvalidWthor", err)
+	}
+}
+
+func TestReadWthorNames(t *testing.T) {
+	file := wthorHeader(0, 2)
+	for _, name := range []string{"Tastet Marc", "Lévy Jacques"} {
+		record := make([]byte, WTHOR_PLAYER_SIZE)
+		for i, r := range []rune(name) {
+			record[i] = byte(r) // Latin-1
+		}
+		file = append(file, record...)
+	}
+	names, err := ReadWthorNames(bytes.NewReader(file), WTHOR_PLAYER_SIZE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "Tastet Marc" || names[1] != "Lévy Jacques" {
+		t.Errorf("names = %q", names)
+	}
+}
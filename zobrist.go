@@ -0,0 +1,64 @@
+package main
+
+import "math/bits"
+
+// Zobrist hashing: every (square, color) pair and the side to move get a random 64 bit key,
+// the hash of a position is the XOR of the keys of what is on the board.
+// Because XOR is its own inverse the hash can be updated incrementally when a move is made.
+
+var (
+	zobristBlack     [64]uint64
+	zobristWhite     [64]uint64
+	zobristFlip      [64]uint64 // zobristBlack ^ zobristWhite, changes the color of a disk in one XOR
+	zobristBlackTurn uint64
+)
+
+func init() {
+	// Fixed seed so that hashes are the same between runs (useful for debugging and stored tables)
+	seed := uint64(0x9E3779B97F4A7C15)
+	for i := 0; i < 64; i++ {
+		zobristBlack[i] = splitMix64(&seed)
+		zobristWhite[i] = splitMix64(&seed)
+		zobristFlip[i] = zobristBlack[i] ^ zobristWhite[i]
+	}
+	zobristBlackTurn = splitMix64(&seed)
+}
+
+// splitMix64 returns the next number of the SplitMix64 sequence, it is small and has good statistical quality.
+func splitMix64(state *uint64) uint64 {
+	*state += 0x9E3779B97F4A7C15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// ZobristHash computes from scratch the hash of the board with the given side to move.
+func (b *Board) ZobristHash(blackTurn bool) uint64 {
+	var hash uint64
+	for m := b.Black; m != 0; m &= m - 1 {
+		hash ^= zobristBlack[bits.TrailingZeros64(m)]
+	}
+	for m := b.White; m != 0; m &= m - 1 {
+		hash ^= zobristWhite[bits.TrailingZeros64(m)]
+	}
+	if blackTurn {
+		hash ^= zobristBlackTurn
+	}
+	return hash
+}
+
+// zobristMoveDelta returns the value to XOR to a hash after a move and its captures.
+// It does not include the change of turn.
+func zobristMoveDelta(forBlack bool, moveIndex uint8, captured uint64) uint64 {
+	var delta uint64
+	if forBlack {
+		delta = zobristBlack[moveIndex]
+	} else {
+		delta = zobristWhite[moveIndex]
+	}
+	for m := captured; m != 0; m &= m - 1 {
+		delta ^= zobristFlip[bits.TrailingZeros64(m)]
+	}
+	return delta
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIncrementalHashAgreesWithZobristHash(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	passes := 0
+	for game := 0; game < 200; game++ {
+		state := InitialState()
+		if state.Hash != state.Boards.ZobristHash(state.BlackTurn) {
+			t.Fatalf("initial hash %#x, from scratch %#x", state.Hash, state.Boards.ZobristHash(state.BlackTurn))
+		}
+		for !IsTerminalState(state) {
+			my, opp := state.Boards.White, state.Boards.Black
+			if state.BlackTurn {
+				my, opp = opp, my
+			}
+			moves := FastArrayOfMoves(generateMoves(my, opp))
+			mover := state.BlackTurn
+			state.ApplyMove(moves[rng.Intn(len(moves))])
+			if state.BlackTurn == mover && !IsTerminalState(state) {
+				passes++ // The opponent had to pass
+			}
+			if want := state.Boards.ZobristHash(state.BlackTurn); state.Hash != want {
+				t.Fatalf("%+v: incremental hash %#x, from scratch %#x", state.Boards, state.Hash, want)
+			}
+		}
+	}
+	if passes == 0 {
+		t.Error("no game had a pass, the hash of the passes was not checked")
+	}
+}
+
+func TestZobristHashDependsOnTurn(t *testing.T) {
+	board := InitialState().Boards
+	if board.ZobristHash(true) == board.ZobristHash(false) {
+		t.Error("the same board with different sides to move has the same hash")
+	}
+	if board.ZobristHash(true)^board.ZobristHash(false) != zobristBlackTurn {
+		t.Error("the hashes of the sides to move do not differ by the turn key")
+	}
+}